@@ -0,0 +1,463 @@
+package authr
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// CombiningAlgorithm determines how the rules matching an attempt are
+// combined into a single answer.
+type CombiningAlgorithm int
+
+const (
+	// FirstApplicable lets the first matching rule decide. This is the
+	// behavior of Can, where the order of the rules is significant.
+	FirstApplicable CombiningAlgorithm = iota
+
+	// DenyOverrides denies if any matching rule denies, and otherwise allows
+	// if any matching rule allows. The order of the rules does not matter.
+	DenyOverrides
+
+	// PermitOverrides allows if any matching rule allows, and otherwise denies.
+	// The order of the rules does not matter.
+	PermitOverrides
+)
+
+func (c CombiningAlgorithm) String() string {
+	switch c {
+	case FirstApplicable:
+		return "first-applicable"
+	case DenyOverrides:
+		return "deny-overrides"
+	case PermitOverrides:
+		return "permit-overrides"
+	}
+	return fmt.Sprintf("CombiningAlgorithm(%d)", int(c))
+}
+
+// Option configures an Authorizer.
+type Option func(*Authorizer)
+
+// WithCombiningAlgorithm sets how the rules matching an attempt are combined.
+// The default is FirstApplicable.
+func WithCombiningAlgorithm(c CombiningAlgorithm) Option {
+	return func(a *Authorizer) {
+		a.algorithm = c
+	}
+}
+
+// WithClock sets the function used to get the current time when checking the
+// validity windows of rules, see Rule.NotBefore and Rule.NotAfter. The default
+// is time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(a *Authorizer) {
+		a.now = now
+	}
+}
+
+// Layer is a named source of rules consulted by an Authorizer configured with
+// Layered.
+type Layer struct {
+	// Name identifies the layer, it must be unique within an Authorizer.
+	Name string
+
+	// Rules returns the layer's rules for the subject being authorized. If nil,
+	// the layer consists of the subject's own rules.
+	Rules func(s Subject) ([]*Rule, error)
+
+	// Terminal stops evaluation at this layer, with a deny, if none of its
+	// rules match the attempt. A non-terminal layer falls through to the next
+	// layer instead.
+	Terminal bool
+}
+
+// StaticRules returns a function for Layer.Rules that returns the same rules
+// for every subject.
+func StaticRules(rules ...*Rule) func(Subject) ([]*Rule, error) {
+	return func(Subject) ([]*Rule, error) {
+		return rules, nil
+	}
+}
+
+// Layered makes the Authorizer consult the provided layers in order instead of
+// only the subject's rules. Within a layer, rules are combined with the
+// configured combining algorithm; the first layer with a matching rule decides
+// the attempt. This allows for guardrails that apply no matter what a subject's
+// GetRules returns:
+//
+//	authr.NewAuthorizer(authr.Layered(
+//		authr.Layer{Name: "guardrails", Rules: authr.StaticRules(noLockedZoneDeletes)},
+//		authr.Layer{Name: "organization", Rules: orgRules},
+//		authr.Layer{Name: "subject", Terminal: true},
+//	))
+//
+// Note that if no layer consults the subject's own rules, they are ignored.
+func Layered(layers ...Layer) Option {
+	return func(a *Authorizer) {
+		a.layers = layers
+	}
+}
+
+// Decision explains the answer to an authorization attempt.
+type Decision struct {
+	// Allowed is the answer to the attempt.
+	Allowed bool
+
+	// Rule is the rule that decided the attempt, or nil if no rule matched
+	// and the attempt was denied by default.
+	Rule *Rule
+
+	// RuleIndex is the index of Rule in the list of rules it came from, or -1
+	// if no rule matched.
+	RuleIndex int
+
+	// RuleID is the ID of Rule, if it has one.
+	RuleID string
+
+	// Layer names where the attempt was decided: the name of the Layer that
+	// decided it, followed by the member of an intersection that decided it
+	// (see Intersect), separated by "/". For example, "subject/boundary" if
+	// the boundary of a Bounded subject denied the attempt in the layer named
+	// "subject". An allowed intersection is attributed to its first member.
+	// Layer is empty if there is nothing to name.
+	Layer string
+
+	// Obligations lists the obligations of the rule that decided the attempt,
+	// or of every rule that allowed an intersection, which must be carried
+	// out for the decision to stand.
+	Obligations []Obligation
+
+	// Reason is the reason given by the rule that decided the attempt, if any.
+	Reason Reason
+
+	// Fallback reports how the attempt was decided despite Cause, the error
+	// retrieving the rules or the resource type, see FallbackRules and
+	// FailOpen.
+	Fallback Fallback
+	Cause    error
+}
+
+func (d Decision) String() string {
+	verdict := "denied"
+	if d.Allowed {
+		verdict = "allowed"
+	}
+	where := ""
+	if d.Layer != "" {
+		where = fmt.Sprintf(" in %q", d.Layer)
+	}
+	if d.Fallback != NoFallback {
+		where += fmt.Sprintf(" (%s: %s)", d.Fallback, d.Cause)
+	}
+	if d.Rule == nil {
+		return fmt.Sprintf("%s, no rule matched%s", verdict, where)
+	}
+	if d.RuleID != "" {
+		return fmt.Sprintf("%s by rule %q%s", verdict, d.RuleID, where)
+	}
+	return fmt.Sprintf("%s by rule %d%s", verdict, d.RuleIndex, where)
+}
+
+// Err returns nil if the attempt was allowed, and otherwise an *ErrForbidden
+// carrying the reason for the denial.
+func (d Decision) Err() error {
+	if d.Allowed {
+		return nil
+	}
+	return &ErrForbidden{
+		Code:      d.Reason.Code,
+		Message:   d.Reason.Message,
+		RuleIndex: d.RuleIndex,
+		RuleID:    d.RuleID,
+		Layer:     d.Layer,
+	}
+}
+
+// Authorizer answers the same question as Can, but can be configured with
+// options that change how the answer is reached. The zero value is not usable,
+// use NewAuthorizer. An Authorizer is safe for concurrent use.
+type Authorizer struct {
+	algorithm CombiningAlgorithm
+	layers    []Layer
+	now       func() time.Time
+	handlers  map[string]ObligationHandler
+
+	fallbackRules []*Rule
+	failOpen      map[string]bool
+	fallbackHook  FallbackHook
+
+	observers []observer
+}
+
+var defaultAuthorizer = NewAuthorizer()
+
+// NewAuthorizer returns an Authorizer configured with the provided options.
+// With no options it behaves exactly like Can.
+func NewAuthorizer(opts ...Option) *Authorizer {
+	a := &Authorizer{algorithm: FirstApplicable, now: time.Now}
+	for _, opt := range opts {
+		opt(a)
+	}
+	switch a.algorithm {
+	case FirstApplicable, DenyOverrides, PermitOverrides:
+	default:
+		panic(fmt.Sprintf("authr: unknown combining algorithm: %s", a.algorithm))
+	}
+	if a.now == nil {
+		panic("authr: clock must not be nil")
+	}
+	names := make(map[string]bool, len(a.layers))
+	for _, l := range a.layers {
+		if l.Name == "" {
+			panic("authr: layer name must not be empty")
+		}
+		if names[l.Name] {
+			panic(fmt.Sprintf("authr: duplicate layer: '%s'", l.Name))
+		}
+		names[l.Name] = true
+	}
+	return a
+}
+
+// Can will answer the question "Can this subject perform this action on this
+// resource?", see the package-level Can.
+//
+// The obligations of the decision are carried out by the handlers registered
+// with WithObligationHandler. If an obligation has no handler, or a handler
+// returns an error, the answer is "no" along with the error.
+func (a *Authorizer) Can(s Subject, action string, r Resource) (bool, error) {
+	start := time.Now()
+	at := &attempt{action: action, r: r, now: a.now()}
+	d, err := a.decideAttempt(s, at)
+	if err == nil {
+		err = a.fulfill(d, r)
+	}
+	a.observe(s, at, d, err, false, start)
+	if err != nil {
+		return false, err
+	}
+	return d.Allowed, nil
+}
+
+// CanWithEnv is just like Can, except conditions in the subject's rules may
+// also reference values in the provided Environment using the "$env." prefix.
+func (a *Authorizer) CanWithEnv(s Subject, action string, r Resource, env Environment) (bool, error) {
+	return a.Can(s, action, envResource{Resource: r, env: env})
+}
+
+// Decide is just like Can, except it returns a Decision explaining the answer
+// and does not carry out its obligations. If an error is returned, the
+// Decision is a denial whose Layer names where the error occurred.
+func (a *Authorizer) Decide(s Subject, action string, r Resource) (Decision, error) {
+	start := time.Now()
+	at := &attempt{action: action, r: r, now: a.now()}
+	d, err := a.decideAttempt(s, at)
+	a.observe(s, at, d, err, false, start)
+	return d, err
+}
+
+func (a *Authorizer) decideAttempt(s Subject, at *attempt) (Decision, error) {
+	d, err := a.decide(s, at)
+	if err != nil && at.loadFailed {
+		return a.fallBack(s, at, d, err)
+	}
+	return d, err
+}
+
+func (a *Authorizer) decide(s Subject, at *attempt) (Decision, error) {
+	if a.layers == nil {
+		d, _, err := a.decideSubject(s, at)
+		return d, err
+	}
+	for n, l := range a.layers {
+		var (
+			d       Decision
+			opinion bool
+			err     error
+		)
+		if l.Rules == nil {
+			d, opinion, err = a.decideSubject(s, at)
+		} else {
+			var rules []*Rule
+			if rules, err = layerRules(s, n, l); err == nil {
+				d, opinion, err = a.decideRules(rules, at)
+			} else {
+				d = Decision{RuleIndex: -1}
+				at.loadFailed = true
+			}
+		}
+		d.Layer = joinLayer(l.Name, d.Layer)
+		if err != nil || opinion || l.Terminal {
+			return d, err
+		}
+	}
+	return Decision{RuleIndex: -1}, nil
+}
+
+// attempt holds what is being authorized while it is decided.
+type attempt struct {
+	action string
+	r      Resource
+	now    time.Time
+	rtype  *string
+
+	// loadFailed reports whether the rules or the resource type could not be
+	// retrieved, as opposed to an error evaluating a rule
+	loadFailed bool
+}
+
+// resourceType returns the type of the resource, only retrieving it once.
+func (at *attempt) resourceType() (string, error) {
+	if at.rtype == nil {
+		t, err := at.r.GetResourceType()
+		if err != nil {
+			at.loadFailed = true
+			return "", err
+		}
+		at.rtype = &t
+	}
+	return *at.rtype, nil
+}
+
+// decideSubject decides the attempt with the subject's rules. The returned
+// bool reports whether the subject had an opinion on the attempt, which is
+// always the case for an intersection.
+func (a *Authorizer) decideSubject(s Subject, at *attempt) (Decision, bool, error) {
+	i, ok := asIntersection(s)
+	if !ok {
+		rules, err := s.GetRules()
+		if err != nil {
+			at.loadFailed = true
+			return Decision{RuleIndex: -1}, false, err
+		}
+		return a.decideRules(rules, at)
+	}
+	var (
+		allowed     Decision
+		obligations []Obligation
+	)
+	for n, m := range i.members {
+		d, _, err := a.decideSubject(m.subject, at)
+		d.Layer = joinLayer(m.name, d.Layer)
+		if err != nil || !d.Allowed {
+			return d, true, err
+		}
+		if n == 0 {
+			allowed = d
+		}
+		obligations = append(obligations, d.Obligations...)
+	}
+	allowed.Obligations = obligations
+	return allowed, true, nil
+}
+
+func (a *Authorizer) decideRules(rules []*Rule, at *attempt) (Decision, bool, error) {
+	in, ok, err := rulesIntersection(rules)
+	if err != nil {
+		return Decision{RuleIndex: -1}, false, err
+	}
+	if ok {
+		return a.decideSubject(in, at)
+	}
+	resourceType, err := at.resourceType()
+	if err != nil {
+		return Decision{RuleIndex: -1}, false, err
+	}
+	rule, i, err := a.combine(rules, resourceType, at)
+	if err != nil {
+		return Decision{RuleIndex: -1}, false, err
+	}
+	if rule == nil {
+		// no rule matched, default to "deny all"
+		return Decision{RuleIndex: -1}, false, nil
+	}
+	return Decision{
+		Allowed:     rule.access == Allow,
+		Rule:        rule,
+		RuleIndex:   i,
+		RuleID:      rule.id,
+		Obligations: rule.obligations,
+		Reason:      rule.reason,
+	}, true, nil
+}
+
+func joinLayer(outer, inner string) string {
+	if outer == "" {
+		return inner
+	}
+	if inner == "" {
+		return outer
+	}
+	return outer + "/" + inner
+}
+
+// combine returns the rule that decides the attempt according to the
+// combining algorithm, along with its index in the list. If no rule matches,
+// the returned rule is nil and the index is -1.
+func (a *Authorizer) combine(rules []*Rule, resourceType string, at *attempt) (*Rule, int, error) {
+	var decided *Rule
+	decidedIndex := -1
+	order := byPriority(rules)
+	for n := range rules {
+		i := n
+		if order != nil {
+			i = order[n]
+		}
+		rule := rules[i]
+		if !rule.validAt(at.now) {
+			continue
+		}
+		ok, err := rule.matches(resourceType, at.action, at.r)
+		if err != nil {
+			return nil, -1, err
+		}
+		if !ok {
+			continue
+		}
+		if rule.access != Allow && rule.access != Deny {
+			// unknown type!
+			panic(fmt.Sprintf("authr: unknown access type: '%s'", rule.access))
+		}
+		switch a.algorithm {
+		case FirstApplicable:
+			return rule, i, nil
+		case DenyOverrides:
+			if rule.access == Deny {
+				return rule, i, nil
+			}
+		case PermitOverrides:
+			if rule.access == Allow {
+				return rule, i, nil
+			}
+		}
+		if decided == nil {
+			decided, decidedIndex = rule, i
+		}
+	}
+	return decided, decidedIndex, nil
+}
+
+// byPriority returns the indices of the rules in the order they should be
+// considered: highest priority first, keeping the original order otherwise. It
+// returns nil if no rule has a priority, meaning the list is already in order.
+func byPriority(rules []*Rule) []int {
+	prioritized := false
+	for _, r := range rules {
+		if r.priority != 0 {
+			prioritized = true
+			break
+		}
+	}
+	if !prioritized {
+		return nil
+	}
+	order := make([]int, len(rules))
+	for i := range rules {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return rules[order[i]].priority > rules[order[j]].priority
+	})
+	return order
+}
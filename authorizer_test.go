@@ -0,0 +1,297 @@
+package authr
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCombiningAlgorithms(t *testing.T) {
+	allow := func(cs ...Evaluator) *Rule {
+		return new(Rule).Access(Allow).Where(Action("delete"), ResourceType("zone"), ResourceMatch(cs...))
+	}
+	deny := func(cs ...Evaluator) *Rule {
+		return new(Rule).Access(Deny).Where(Action("delete"), ResourceType("zone"), ResourceMatch(cs...))
+	}
+	zone := testResource{rtype: "zone", attributes: map[string]interface{}{"locked": true, "plan": "ent"}}
+	lists := map[string][]*Rule{
+		"no rules":             {},
+		"no matching rules":    {allow(Cond("@plan", "=", "free")), deny(Cond("@locked", "=", false))},
+		"only allows":          {allow(Cond("@plan", "=", "ent"))},
+		"only denies":          {deny(Cond("@locked", "=", true))},
+		"allow before deny":    {allow(Cond("@plan", "=", "ent")), deny(Cond("@locked", "=", true))},
+		"deny before allow":    {deny(Cond("@locked", "=", true)), allow(Cond("@plan", "=", "ent"))},
+		"prioritized deny":     {allow(), deny().Priority(10)},
+		"prioritized allow":    {deny(), allow().Priority(1), deny().Priority(-1)},
+		"equal priority order": {allow().Priority(5), deny().Priority(5)},
+	}
+	expectations := map[CombiningAlgorithm]map[string]bool{
+		FirstApplicable: {
+			"no rules":             false,
+			"no matching rules":    false,
+			"only allows":          true,
+			"only denies":          false,
+			"allow before deny":    true,
+			"deny before allow":    false,
+			"prioritized deny":     false,
+			"prioritized allow":    true,
+			"equal priority order": true,
+		},
+		DenyOverrides: {
+			"no rules":             false,
+			"no matching rules":    false,
+			"only allows":          true,
+			"only denies":          false,
+			"allow before deny":    false,
+			"deny before allow":    false,
+			"prioritized deny":     false,
+			"prioritized allow":    false,
+			"equal priority order": false,
+		},
+		PermitOverrides: {
+			"no rules":             false,
+			"no matching rules":    false,
+			"only allows":          true,
+			"only denies":          false,
+			"allow before deny":    true,
+			"deny before allow":    true,
+			"prioritized deny":     true,
+			"prioritized allow":    true,
+			"equal priority order": true,
+		},
+	}
+	for alg, cases := range expectations {
+		a := NewAuthorizer(WithCombiningAlgorithm(alg))
+		for name, want := range cases {
+			t.Run(fmt.Sprintf("%s with %s", alg, name), func(t *testing.T) {
+				ok, err := a.Can(RuleList(lists[name]), "delete", zone)
+				require.Nil(t, err)
+				require.Equal(t, want, ok)
+			})
+		}
+	}
+}
+
+func TestAuthorizerMatchesCan(t *testing.T) {
+	a := NewAuthorizer()
+	for _, c := range testCan_getCases() {
+		t.Run(fmt.Sprintf("given %s, Authorizer.Can() should %s", c.g, c.s), func(t *testing.T) {
+			want, wantErr := Can(c.subject, c.act, c.resource)
+			got, gotErr := a.Can(c.subject, c.act, c.resource)
+			require.Equal(t, wantErr, gotErr)
+			require.Equal(t, want, got)
+		})
+	}
+}
+
+func TestAuthorizerErrors(t *testing.T) {
+	failing := new(Rule).Access(Allow).Where(Action("delete"), ResourceType("zone"), ResourceMatch(Cond("@id", "$in", 5)))
+	allow := new(Rule).Access(Allow).Where(Action("delete"), ResourceType("zone"), ResourceMatch())
+	for _, alg := range []CombiningAlgorithm{FirstApplicable, DenyOverrides, PermitOverrides} {
+		t.Run(fmt.Sprintf("%s should fail closed on rule errors", alg), func(t *testing.T) {
+			ok, err := NewAuthorizer(WithCombiningAlgorithm(alg)).Can(RuleList{failing, allow}, "delete", testResource{rtype: "zone"})
+			require.NotNil(t, err)
+			require.False(t, ok)
+		})
+	}
+	t.Run("should panic on unknown combining algorithms", func(t *testing.T) {
+		require.Panics(t, func() {
+			NewAuthorizer(WithCombiningAlgorithm(CombiningAlgorithm(42)))
+		})
+	})
+}
+
+func TestLayered(t *testing.T) {
+	noLockedDeletes := new(Rule).Access(Deny).Where(Action("delete"), ResourceType("zone"), ResourceMatch(Cond("@locked", "=", true)))
+	allowDeletes := new(Rule).Access(Allow).Where(Action("delete"), ResourceType("zone"), ResourceMatch())
+	denyDeletes := new(Rule).Access(Deny).Where(Action("delete"), ResourceType("zone"), ResourceMatch())
+	locked := testResource{rtype: "zone", attributes: map[string]interface{}{"locked": true}}
+	unlocked := testResource{rtype: "zone", attributes: map[string]interface{}{"locked": false}}
+	guardrails := Layer{Name: "guardrails", Rules: StaticRules(noLockedDeletes)}
+
+	t.Run("should let guardrails override the subject's rules", func(t *testing.T) {
+		a := NewAuthorizer(Layered(guardrails, Layer{Name: "subject"}))
+		ok, err := a.Can(RuleList{allowDeletes}, "delete", locked)
+		require.Nil(t, err)
+		require.False(t, ok)
+		ok, err = a.Can(RuleList{allowDeletes}, "delete", unlocked)
+		require.Nil(t, err)
+		require.True(t, ok)
+	})
+	t.Run("should stop at a terminal layer with no matching rules", func(t *testing.T) {
+		a := NewAuthorizer(Layered(
+			Layer{Name: "organization", Rules: StaticRules(), Terminal: true},
+			Layer{Name: "subject"},
+		))
+		ok, err := a.Can(RuleList{allowDeletes}, "delete", unlocked)
+		require.Nil(t, err)
+		require.False(t, ok)
+	})
+	t.Run("should let a terminal layer's match decide", func(t *testing.T) {
+		a := NewAuthorizer(Layered(
+			Layer{Name: "organization", Rules: StaticRules(allowDeletes), Terminal: true},
+			Layer{Name: "subject"},
+		))
+		ok, err := a.Can(RuleList{denyDeletes}, "delete", unlocked)
+		require.Nil(t, err)
+		require.True(t, ok)
+	})
+	t.Run("should deny if no layer has an opinion", func(t *testing.T) {
+		a := NewAuthorizer(Layered(guardrails, Layer{Name: "subject"}))
+		ok, err := a.Can(RuleList{}, "delete", unlocked)
+		require.Nil(t, err)
+		require.False(t, ok)
+	})
+	t.Run("should pass the subject to the layer", func(t *testing.T) {
+		orgs := map[string][]*Rule{"acme": {allowDeletes}}
+		a := NewAuthorizer(Layered(Layer{
+			Name: "organization",
+			Rules: func(s Subject) ([]*Rule, error) {
+				return orgs[s.(testOrgSubject).org], nil
+			},
+		}))
+		ok, err := a.Can(testOrgSubject{org: "acme"}, "delete", unlocked)
+		require.Nil(t, err)
+		require.True(t, ok)
+		ok, err = a.Can(testOrgSubject{org: "initech"}, "delete", unlocked)
+		require.Nil(t, err)
+		require.False(t, ok)
+	})
+	t.Run("should combine rules within a layer with the combining algorithm", func(t *testing.T) {
+		a := NewAuthorizer(
+			WithCombiningAlgorithm(DenyOverrides),
+			Layered(Layer{Name: "subject"}),
+		)
+		ok, err := a.Can(RuleList{allowDeletes, denyDeletes}, "delete", unlocked)
+		require.Nil(t, err)
+		require.False(t, ok)
+	})
+	t.Run("should return errors from layers", func(t *testing.T) {
+		a := NewAuthorizer(Layered(Layer{
+			Name: "organization",
+			Rules: func(Subject) ([]*Rule, error) {
+				return nil, Error("organization unavailable")
+			},
+		}))
+		ok, err := a.Can(RuleList{allowDeletes}, "delete", unlocked)
+		require.Equal(t, Error("organization unavailable"), err)
+		require.False(t, ok)
+	})
+	t.Run("should panic on invalid layers", func(t *testing.T) {
+		require.Panics(t, func() {
+			NewAuthorizer(Layered(Layer{}))
+		})
+		require.Panics(t, func() {
+			NewAuthorizer(Layered(Layer{Name: "subject"}, Layer{Name: "subject"}))
+		})
+	})
+}
+
+type testOrgSubject struct {
+	org string
+}
+
+func (testOrgSubject) GetRules() ([]*Rule, error) {
+	return nil, nil
+}
+
+func TestDecide(t *testing.T) {
+	noLockedDeletes := new(Rule).Access(Deny).Where(Action("delete"), ResourceType("zone"), ResourceMatch(Cond("@locked", "=", true)))
+	allowDeletes := new(Rule).Access(Allow).Where(Action("delete"), ResourceType("zone"), ResourceMatch())
+	locked := testResource{rtype: "zone", attributes: map[string]interface{}{"locked": true}}
+	unlocked := testResource{rtype: "zone", attributes: map[string]interface{}{"locked": false}}
+	a := NewAuthorizer(Layered(
+		Layer{Name: "guardrails", Rules: StaticRules(noLockedDeletes)},
+		Layer{Name: "subject", Terminal: true},
+	))
+	cases := []struct {
+		n        string
+		s        Subject
+		r        Resource
+		d        Decision
+		stringer string
+	}{
+		{
+			n:        "should name the layer that denied",
+			s:        RuleList{allowDeletes},
+			r:        locked,
+			d:        Decision{Rule: noLockedDeletes, RuleIndex: 0, Layer: "guardrails"},
+			stringer: `denied by rule 0 in "guardrails"`,
+		},
+		{
+			n:        "should name the layer that allowed",
+			s:        RuleList{noLockedDeletes, allowDeletes},
+			r:        unlocked,
+			d:        Decision{Allowed: true, Rule: allowDeletes, RuleIndex: 1, Layer: "subject"},
+			stringer: `allowed by rule 1 in "subject"`,
+		},
+		{
+			n:        "should name the terminal layer that stopped evaluation",
+			s:        RuleList{},
+			r:        unlocked,
+			d:        Decision{RuleIndex: -1, Layer: "subject"},
+			stringer: `denied, no rule matched in "subject"`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.n, func(t *testing.T) {
+			d, err := a.Decide(c.s, "delete", c.r)
+			require.Nil(t, err)
+			require.Equal(t, c.d, d)
+			require.Equal(t, c.stringer, d.String())
+		})
+	}
+	t.Run("should not name a layer without layers", func(t *testing.T) {
+		d, err := Decide(RuleList{}, "delete", unlocked)
+		require.Nil(t, err)
+		require.Equal(t, Decision{RuleIndex: -1}, d)
+		require.Equal(t, "denied, no rule matched", d.String())
+	})
+}
+
+func TestValidityWindows(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	temporary := new(Rule).
+		Access(Allow).
+		NotBefore(start).
+		NotAfter(end).
+		Where(Action("delete"), ResourceType("zone"), ResourceMatch())
+	fallback := new(Rule).Access(Deny).Where(Action("delete"), ResourceType("zone"), ResourceMatch())
+	cases := []struct {
+		n    string
+		now  time.Time
+		want bool
+	}{
+		{"should skip rules before their window", start.Add(-time.Nanosecond), false},
+		{"should include the start of the window", start, true},
+		{"should apply rules within their window", start.Add(30 * time.Minute), true},
+		{"should skip rules at the end of their window", end, false},
+		{"should skip expired rules", end.Add(time.Hour), false},
+	}
+	for _, c := range cases {
+		t.Run(c.n, func(t *testing.T) {
+			now := c.now
+			a := NewAuthorizer(WithClock(func() time.Time { return now }))
+			d, err := a.Decide(RuleList{temporary, fallback}, "delete", testResource{rtype: "zone"})
+			require.Nil(t, err)
+			require.Equal(t, c.want, d.Allowed)
+			if !c.want {
+				require.Equal(t, fallback, d.Rule)
+			}
+		})
+	}
+	t.Run("should apply open-ended windows", func(t *testing.T) {
+		a := NewAuthorizer(WithClock(func() time.Time { return end }))
+		ok, err := a.Can(RuleList{new(Rule).Access(Allow).NotBefore(start).Where(Action("delete"), ResourceType("zone"), ResourceMatch())}, "delete", testResource{rtype: "zone"})
+		require.Nil(t, err)
+		require.True(t, ok)
+	})
+	t.Run("should panic on a nil clock", func(t *testing.T) {
+		require.Panics(t, func() {
+			NewAuthorizer(WithClock(nil))
+		})
+	})
+}
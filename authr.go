@@ -5,23 +5,30 @@ import (
 	"reflect"
 	"regexp"
 	"strings"
+	"time"
 )
 
 var rcache regexpCache = &noopRegexpCache{}
 
 var (
 	operators = map[string]operator{
-		"=":    operatorFunc(looseEquality),
-		"!=":   negate(operatorFunc(looseEquality)),
-		"$in":  in("$in", false),
-		"$nin": in("$nin", true),
-		"~=":   operatorFunc(like),
-		"&":    intersect("&", false),
-		"-":    intersect("-", true),
-		"~":    &regexpOperator{ci: false, inv: false},
-		"~*":   &regexpOperator{ci: true, inv: false},
-		"!~":   &regexpOperator{ci: false, inv: true},
-		"!~*":  &regexpOperator{ci: true, inv: true},
+		"=":         operatorFunc(looseEquality),
+		"!=":        negate(operatorFunc(looseEquality)),
+		"$in":       in("$in", false),
+		"$nin":      in("$nin", true),
+		"~=":        operatorFunc(like),
+		"&":         intersect("&", false),
+		"-":         intersect("-", true),
+		"$superset": subset("$superset", false),
+		"$subset":   subset("$subset", true),
+		"$seteq":    setEquality("$seteq"),
+		"$len":      operatorFunc(length),
+		"$haskey":   operatorFunc(hasKey),
+		"$hasentry": operatorFunc(hasEntry),
+		"~":         &regexpOperator{ci: false, inv: false},
+		"~*":        &regexpOperator{ci: true, inv: false},
+		"!~":        &regexpOperator{ci: false, inv: true},
+		"!~*":       &regexpOperator{ci: true, inv: true},
 	}
 )
 
@@ -102,6 +109,46 @@ type Resource interface {
 	GetResourceAttribute(string) (interface{}, error)
 }
 
+// Environment is an abstract representation of facts about the request being
+// made that are not attributes of the resource: the client's IP address, the
+// time of the request, whether the subject authenticated with MFA, etc.
+//
+// Conditions reference these values with a "$env." prefix, for example:
+//
+//	Cond("$env.mfa", "=", true)
+//
+// Unknown or missing values should simply return "nil" and not an error.
+type Environment interface {
+	GetEnvironmentValue(string) (interface{}, error)
+}
+
+// Env is a simple Environment backed by a map.
+type Env map[string]interface{}
+
+func (e Env) GetEnvironmentValue(key string) (interface{}, error) {
+	return e[key], nil
+}
+
+// envResource carries an Environment alongside a Resource so that conditions
+// can resolve "$env." references during evaluation.
+type envResource struct {
+	Resource
+	env Environment
+}
+
+// splitEnv separates a resource from the Environment it carries, returning an
+// empty Environment if there is none.
+func splitEnv(r Resource) (Resource, Environment) {
+	er, ok := r.(envResource)
+	if !ok {
+		return r, Env{}
+	}
+	if er.env == nil {
+		return er.Resource, Env{}
+	}
+	return er.Resource, er.env
+}
+
 // Rule represents the basic building block of an access control system. They
 // can be likened to a single statement in an access-control list (ACL). Rules
 // are entities which are said to "belong" to subjects in that they have been
@@ -126,13 +173,101 @@ type Resource interface {
 // might be to have a dedicate .go file that specifies rules where you can dot
 // import authr. (https://golang.org/ref/spec#Import_declarations)
 type Rule struct {
-	access Access
-	where  struct {
+	id       string
+	version  int
+	access   Access
+	priority int
+	where    struct {
 		resourceType  SlugSet
 		resourceMatch ConditionSet
 		action        SlugSet
 	}
-	meta interface{}
+	notBefore, notAfter time.Time
+	obligations         []Obligation
+	reason              Reason
+	meta                interface{}
+
+	// members is set on the rule standing for an intersection, see
+	// intersection.GetRules
+	members []member
+}
+
+// GetID returns the identifier of the rule, or an empty string if it has none.
+func (r *Rule) GetID() string {
+	return r.id
+}
+
+// GetVersion returns the version of the rule.
+func (r *Rule) GetVersion() int {
+	return r.version
+}
+
+// GetAccess returns whether the rule allows or denies when matched.
+func (r *Rule) GetAccess() Access {
+	return r.access
+}
+
+// Actions returns the "action" section of the rule.
+func (r *Rule) Actions() SlugSet {
+	return r.where.action
+}
+
+// ResourceTypes returns the "rsrc_type" section of the rule.
+func (r *Rule) ResourceTypes() SlugSet {
+	return r.where.resourceType
+}
+
+// Conditions returns the "rsrc_match" section of the rule.
+func (r *Rule) Conditions() ConditionSet {
+	return r.where.resourceMatch
+}
+
+// GetPriority returns the priority of the rule.
+func (r *Rule) GetPriority() int {
+	return r.priority
+}
+
+// GetNotBefore returns the time the rule becomes valid, or the zero time if it
+// has no start.
+func (r *Rule) GetNotBefore() time.Time {
+	return r.notBefore
+}
+
+// GetNotAfter returns the time the rule stops being valid, or the zero time if
+// it never expires.
+func (r *Rule) GetNotAfter() time.Time {
+	return r.notAfter
+}
+
+// GetObligations returns the obligations attached to the rule.
+func (r *Rule) GetObligations() []Obligation {
+	return r.obligations
+}
+
+// GetReason returns the reason given by the rule, which is the zero Reason if
+// it has none.
+func (r *Rule) GetReason() Reason {
+	return r.reason
+}
+
+// GetMeta returns whatever was provided as the "$meta" of the rule.
+func (r *Rule) GetMeta() interface{} {
+	return r.meta
+}
+
+// ID sets the identifier of the rule, which references it stably in decisions,
+// audit logs and rule management APIs regardless of its position in a list.
+// See RuleList.Validate.
+func (r Rule) ID(id string) *Rule {
+	r.id = id
+	return &r
+}
+
+// Version sets the version of the rule, for tracking revisions of a rule with
+// the same ID. The default version is 0.
+func (r Rule) Version(v int) *Rule {
+	r.version = v
+	return &r
 }
 
 func (r Rule) Access(at Access) *Rule {
@@ -140,6 +275,56 @@ func (r Rule) Access(at Access) *Rule {
 	return &r
 }
 
+// Priority sets the priority of the rule. Rules with a higher priority are
+// considered before rules with a lower one, regardless of their position in
+// the list; rules of equal priority keep their relative order. The default
+// priority is 0.
+func (r Rule) Priority(p int) *Rule {
+	r.priority = p
+	return &r
+}
+
+// NotBefore sets the time the rule becomes valid. Until then, the rule is
+// skipped as if it did not exist. The zero time removes the restriction.
+func (r Rule) NotBefore(t time.Time) *Rule {
+	r.notBefore = t
+	return &r
+}
+
+// NotAfter sets the time the rule stops being valid, which is useful for
+// temporary grants. From then on, the rule is skipped as if it did not exist.
+// The zero time removes the restriction.
+func (r Rule) NotAfter(t time.Time) *Rule {
+	r.notAfter = t
+	return &r
+}
+
+// validAt checks if t is within the rule's validity window, which includes its
+// start but not its end.
+func (r *Rule) validAt(t time.Time) bool {
+	if !r.notBefore.IsZero() && t.Before(r.notBefore) {
+		return false
+	}
+	if !r.notAfter.IsZero() && !t.Before(r.notAfter) {
+		return false
+	}
+	return true
+}
+
+// Obligations attaches obligations to the rule, which must be carried out when
+// the rule decides an attempt, see Obligation.
+func (r Rule) Obligations(obligations ...Obligation) *Rule {
+	r.obligations = obligations
+	return &r
+}
+
+// Reason sets the machine-readable code and the human-readable message
+// explaining the rule's decision, returned in a Decision and its error.
+func (r Rule) Reason(code, message string) *Rule {
+	r.reason = Reason{Code: code, Message: message}
+	return &r
+}
+
 func (r Rule) Meta(meta interface{}) *Rule {
 	r.meta = meta
 	return &r
@@ -152,25 +337,53 @@ func (r Rule) Where(action, resourceType SlugSet, conditions ConditionSet) *Rule
 	return &r
 }
 
-type slugSetMode int
+// SlugSetMode determines how the elements of a SlugSet are matched.
+type SlugSetMode int
 
 const (
-	allowlist slugSetMode = iota
-	blocklist
-	wildcard
+	// Allowlist matches only the elements in the set
+	Allowlist SlugSetMode = iota
+
+	// Blocklist matches anything except the elements in the set
+	Blocklist
+
+	// Wildcard matches anything, the set has no elements
+	Wildcard
 )
 
+func (m SlugSetMode) String() string {
+	switch m {
+	case Allowlist:
+		return "allowlist"
+	case Blocklist:
+		return "blocklist"
+	case Wildcard:
+		return "wildcard"
+	}
+	return fmt.Sprintf("SlugSetMode(%d)", int(m))
+}
+
 // SlugSet is an internal means of representing an arbitrary set of strings. The
 // "rsrc_type" and "action" sections of a rule have this type.
 type SlugSet struct {
-	mode     slugSetMode
+	mode     SlugSetMode
 	elements []string
 }
 
+// Mode returns how the elements of the set are matched.
+func (s SlugSet) Mode() SlugSetMode {
+	return s.mode
+}
+
+// Elements returns a copy of the strings in the set.
+func (s SlugSet) Elements() []string {
+	return append([]string{}, s.elements...)
+}
+
 func newSlugSet(slugs []string) SlugSet {
 	ss := SlugSet{}
 	if len(slugs) == 1 && slugs[0] == "*" {
-		ss.mode = wildcard
+		ss.mode = Wildcard
 		slugs = []string{}
 	}
 	ss.elements = slugs
@@ -192,12 +405,12 @@ func Action(sset ...string) SlugSet {
 // Not will return a copy of the provided SlugSet that will operate in a blocklist
 // mode. Meaning the elements if matched in a calculation will return "false"
 func Not(s SlugSet) SlugSet {
-	s.mode = blocklist
+	s.mode = Blocklist
 	return s
 }
 
 func (s SlugSet) contains(b string) (bool, error) {
-	if s.mode == wildcard {
+	if s.mode == Wildcard {
 		return true, nil
 	}
 	contained := false
@@ -207,9 +420,9 @@ func (s SlugSet) contains(b string) (bool, error) {
 			break
 		}
 	}
-	if s.mode == blocklist {
+	if s.mode == Blocklist {
 		return !contained, nil
-	} else if s.mode == allowlist {
+	} else if s.mode == Allowlist {
 		return contained, nil
 	}
 	panic(fmt.Sprintf("unknown slugset mode: '%v'", s.mode))
@@ -220,6 +433,17 @@ type ConditionSet struct {
 	evaluators []Evaluator
 }
 
+// Conjunction returns the logic joining the evaluators in the set, either
+// "$and" or "$or".
+func (c ConditionSet) Conjunction() string {
+	return c.conj.String()
+}
+
+// Evaluators returns a copy of the evaluators in the set.
+func (c ConditionSet) Evaluators() []Evaluator {
+	return append([]Evaluator{}, c.evaluators...)
+}
+
 // ResourceMatch is just a more readable way to start the rsrc_match section of
 // a rule. It uses the implied logical conjunction AND.
 func ResourceMatch(es ...Evaluator) ConditionSet {
@@ -273,67 +497,118 @@ func (c ConditionSet) evaluate(r Resource) (bool, error) {
 // Can is the core access control computation function. It takes in a subject,
 // action, and resource. It will answer the question "Can this subject perform
 // this action on this resource?".
+//
+// The first rule that matches determines the answer, and if no rule matches
+// the answer is "no". Use an Authorizer to combine rules in other ways.
+//
+// Can has no obligation handlers, so the answer is always "no" if the deciding
+// rule has obligations. Use an Authorizer with WithObligationHandler, or
+// Decide, for rules with obligations.
 func Can(s Subject, action string, r Resource) (bool, error) {
+	return defaultAuthorizer.Can(s, action, r)
+}
+
+// Decide is just like Can, except it returns a Decision explaining the answer
+// and does not carry out its obligations.
+func Decide(s Subject, action string, r Resource) (Decision, error) {
+	return defaultAuthorizer.Decide(s, action, r)
+}
+
+// PartialEval answers the question "Which resources of this type can this
+// subject perform this action on?" without loading any of them, like for a
+// list endpoint. Rules that do not apply to the resource type and action are
+// discarded, conditions on the known attributes are evaluated, and what
+// remains is returned as an expression over the unknown attributes that is
+// true for exactly the resources Can would allow. For example, the rules
+//
+//	deny  post.edit where @locked = true
+//	allow post.edit where @author_id = 1
+//	allow post.edit where @public = true
+//
+// produce the residual expression
+//
+//	(NOT @locked = true AND @author_id = 1) OR (NOT @locked = true AND @public = true)
+//
+// Rules containing predicates cannot be partially evaluated and return an
+// error. The obligations of rules are not reflected in the expression.
+func PartialEval(s Subject, action, resourceType string, known map[string]interface{}) (Expr, error) {
+	return defaultAuthorizer.PartialEval(s, action, resourceType, known)
+}
+
+// PartialEvalWithEnv is just like PartialEval, except conditions may also
+// reference values in the provided Environment using the "$env." prefix.
+func PartialEvalWithEnv(s Subject, action, resourceType string, known map[string]interface{}, env Environment) (Expr, error) {
+	return defaultAuthorizer.PartialEvalWithEnv(s, action, resourceType, known, env)
+}
+
+// matches checks if the rule applies to the resource type, action and the
+// resource's attributes.
+func (rule *Rule) matches(resourceType, action string, r Resource) (bool, error) {
 	var (
-		err          error
-		rules        []*Rule
-		resourceType string
+		ok  bool
+		err error
 	)
-	if rules, err = s.GetRules(); err != nil {
+	if ok, err = rule.where.resourceType.contains(resourceType); err != nil {
 		return false, err
 	}
-	if resourceType, err = r.GetResourceType(); err != nil {
+	if !ok {
+		return false, nil
+	}
+	if ok, err = rule.where.action.contains(action); err != nil {
 		return false, err
 	}
-	for _, rule := range rules {
-		var (
-			ok  bool
-			err error
-		)
-		if ok, err = rule.where.resourceType.contains(resourceType); err != nil {
-			return false, err
-		}
-		if !ok {
-			continue
-		}
-		if ok, err = rule.where.action.contains(action); err != nil {
-			return false, err
-		}
-		if !ok {
-			continue
-		}
-		if ok, err = rule.where.resourceMatch.evaluate(r); err != nil {
-			return false, err
-		}
-		if !ok {
-			continue
-		}
-
-		if rule.access == Allow {
-			return true, nil
-		} else if rule.access == Deny {
-			return false, nil
-		}
-
-		// unknown type!
-		panic(fmt.Sprintf("authr: unknown access type: '%s'", rule.access))
+	if !ok {
+		return false, nil
 	}
+	return rule.where.resourceMatch.evaluate(r)
+}
 
-	// default to "deny all"
-	return false, nil
+// CanWithEnv is just like Can, except conditions in the subject's rules may
+// also reference values in the provided Environment using the "$env." prefix.
+func CanWithEnv(s Subject, action string, r Resource, env Environment) (bool, error) {
+	return defaultAuthorizer.CanWithEnv(s, action, r, env)
 }
 
 // Evaluator is an abstract representation of something that is capable of
-// analyzing a Resource
+// analyzing a Resource. Go-native conditions can be plugged in by implementing
+// Predicate and wrapping it with Custom or Fn.
 type Evaluator interface {
 	evaluate(Resource) (bool, error)
 }
 
+// Condition is the read-only view of an Evaluator returned from Cond.
+type Condition interface {
+	Evaluator
+	Left() interface{}
+	Operator() string
+	Right() interface{}
+}
+
 type condition struct {
 	left, right interface{}
 	op          string
 }
 
+func (c condition) Left() interface{} {
+	return exposeOperand(c.left)
+}
+
+func (c condition) Operator() string {
+	return c.op
+}
+
+func (c condition) Right() interface{} {
+	return exposeOperand(c.right)
+}
+
+// exposeOperand returns a bound literal the way it would be written in a rule.
+func exposeOperand(operand interface{}) interface{} {
+	if l, ok := operand.(literal); ok {
+		return l.escaped()
+	}
+	return operand
+}
+
 // Cond is the basic unit of a resource match section of a rule. It represents
 // a single condition to be evaluated against a Resource. Constructing a
 // condition should be quite natural, like so:
@@ -382,18 +657,40 @@ func (c condition) evaluate(r Resource) (bool, error) {
 	return _operator.compute(left, right)
 }
 
+const envPrefix = "$env."
+
 func determineValue(r Resource, a interface{}) (interface{}, error) {
+	if p, ok := a.(Param); ok {
+		return nil, Error(fmt.Sprintf("unbound parameter: '%s'", p))
+	}
+	if l, ok := a.(literal); ok {
+		return string(l), nil
+	}
 	if str, ok := a.(string); ok && len(str) > 0 {
 		if str[0] == '@' {
 			return r.GetResourceAttribute(str[1:])
 		}
+		if strings.HasPrefix(str, envPrefix) {
+			return environmentValue(r, str[len(envPrefix):])
+		}
 		if len(str) >= 2 && str[0:2] == "\\@" {
 			a = (str[1:])
 		}
+		if strings.HasPrefix(str, "\\"+envPrefix) {
+			a = (str[1:])
+		}
 	}
 	return a, nil
 }
 
+func environmentValue(r Resource, key string) (interface{}, error) {
+	er, ok := r.(envResource)
+	if !ok || er.env == nil {
+		return nil, nil
+	}
+	return er.env.GetEnvironmentValue(key)
+}
+
 type operator interface {
 	compute(left, right interface{}) (bool, error)
 }
@@ -416,12 +713,9 @@ func negate(op operator) operator {
 
 func intersect(opsym string, inv bool) operator {
 	return operatorFunc(func(left, right interface{}) (bool, error) {
-		lv, rv := reflect.ValueOf(left), reflect.ValueOf(right)
-		if !isArrayIsh(lv) {
-			return false, Error(fmt.Sprintf("%s operator expects both operands to be an array or slice, received %T for left operand", opsym, left))
-		}
-		if !isArrayIsh(rv) {
-			return false, Error(fmt.Sprintf("%s operator expects both operands to be an array or slice, received %T for right operand", opsym, right))
+		lv, rv, err := arrayOperands(opsym, left, right)
+		if err != nil {
+			return false, err
 		}
 		for i := 0; i < lv.Len(); i++ {
 			for j := 0; j < rv.Len(); j++ {
@@ -438,11 +732,204 @@ func intersect(opsym string, inv bool) operator {
 	})
 }
 
+// subset returns an operator that checks if every element of one operand can
+// be found in the other. By default the left operand must contain every
+// element of the right (superset), flip reverses that (subset).
+func subset(opsym string, flip bool) operator {
+	return operatorFunc(func(left, right interface{}) (bool, error) {
+		lv, rv, err := arrayOperands(opsym, left, right)
+		if err != nil {
+			return false, err
+		}
+		if flip {
+			return containsAll(rv, lv)
+		}
+		return containsAll(lv, rv)
+	})
+}
+
+func setEquality(opsym string) operator {
+	return operatorFunc(func(left, right interface{}) (bool, error) {
+		lv, rv, err := arrayOperands(opsym, left, right)
+		if err != nil {
+			return false, err
+		}
+		ok, err := containsAll(lv, rv)
+		if err != nil || !ok {
+			return false, err
+		}
+		return containsAll(rv, lv)
+	})
+}
+
+// containsAll will check that every element in b is loosely equal to at least
+// one element in a. Since elements are only ever checked for membership,
+// duplicates in either operand have no effect on the result.
+func containsAll(a, b reflect.Value) (bool, error) {
+	for i := 0; i < b.Len(); i++ {
+		found := false
+		for j := 0; j < a.Len(); j++ {
+			ok, err := looseEquality(a.Index(j).Interface(), b.Index(i).Interface())
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func arrayOperands(opsym string, left, right interface{}) (reflect.Value, reflect.Value, error) {
+	lv, rv := reflect.ValueOf(left), reflect.ValueOf(right)
+	if !isArrayIsh(lv) {
+		return lv, rv, Error(fmt.Sprintf("%s operator expects both operands to be an array or slice, received %T for left operand", opsym, left))
+	}
+	if !isArrayIsh(rv) {
+		return lv, rv, Error(fmt.Sprintf("%s operator expects both operands to be an array or slice, received %T for right operand", opsym, right))
+	}
+	return lv, rv, nil
+}
+
 func isArrayIsh(v reflect.Value) bool {
 	k := v.Kind()
 	return k == reflect.Array || k == reflect.Slice
 }
 
+func isMapIsh(v reflect.Value) bool {
+	return v.Kind() == reflect.Map
+}
+
+// length compares the number of elements in the left operand against the
+// right operand. The right operand is either a number, which is checked for
+// equality, or a two element array of a comparison and a number, like so:
+//
+//	Cond("@members", "$len", []interface{}{">=", 2})
+//
+// A nil left operand, which is usually a missing attribute, has a length of 0.
+func length(left, right interface{}) (bool, error) {
+	var n int
+	if left != nil {
+		lv := reflect.ValueOf(left)
+		if !isArrayIsh(lv) && !isMapIsh(lv) {
+			return false, Error(fmt.Sprintf("$len operator expects the left operand to be an array, slice or map, received %T", left))
+		}
+		n = lv.Len()
+	}
+	cmp, want := "=", right
+	if rv := reflect.ValueOf(right); isArrayIsh(rv) {
+		if rv.Len() != 2 {
+			return false, Error(fmt.Sprintf("$len operator expects the right operand to be a number or a [comparison, number] pair, received %d elements", rv.Len()))
+		}
+		var ok bool
+		if cmp, ok = rv.Index(0).Interface().(string); !ok {
+			return false, Error(fmt.Sprintf("$len operator expects the comparison to be a string, received %T", rv.Index(0).Interface()))
+		}
+		want = rv.Index(1).Interface()
+	}
+	if !isnumber(want) {
+		return false, Error(fmt.Sprintf("$len operator expects a numeric length, received %T", want))
+	}
+	l, w := float64(n), numbertofloat64(want)
+	switch cmp {
+	case "=":
+		return l == w, nil
+	case "!=":
+		return l != w, nil
+	case "<":
+		return l < w, nil
+	case "<=":
+		return l <= w, nil
+	case ">":
+		return l > w, nil
+	case ">=":
+		return l >= w, nil
+	}
+	return false, Error(fmt.Sprintf("unknown comparison for $len operator: '%s'", cmp))
+}
+
+// hasKey checks if the left operand, a map, has a key that is loosely equal to
+// the right operand. A nil left operand has no keys.
+func hasKey(left, right interface{}) (bool, error) {
+	if left == nil {
+		return false, nil
+	}
+	lv := reflect.ValueOf(left)
+	if !isMapIsh(lv) {
+		return false, Error(fmt.Sprintf("$haskey operator expects the left operand to be a map, received %T", left))
+	}
+	values, err := mapLookup(lv, right)
+	return len(values) > 0, err
+}
+
+// hasEntry checks if the left operand, a map, contains every key-value pair
+// in the right operand, also a map. Keys and values are compared loosely.
+func hasEntry(left, right interface{}) (bool, error) {
+	rv := reflect.ValueOf(right)
+	if !isMapIsh(rv) {
+		return false, Error(fmt.Sprintf("$hasentry operator expects the right operand to be a map, received %T", right))
+	}
+	if left == nil {
+		return rv.Len() == 0, nil
+	}
+	lv := reflect.ValueOf(left)
+	if !isMapIsh(lv) {
+		return false, Error(fmt.Sprintf("$hasentry operator expects the left operand to be a map, received %T", left))
+	}
+	iter := rv.MapRange()
+	for iter.Next() {
+		values, err := mapLookup(lv, iter.Key().Interface())
+		if err != nil {
+			return false, err
+		}
+		found := false
+		for _, v := range values {
+			if found, err = looseEquality(v.Interface(), iter.Value().Interface()); err != nil {
+				return false, err
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// mapLookup returns the values of the map's keys that are loosely equal to the
+// key. A key of the exact same type takes precedence, so that the result does
+// not depend on the iteration order of the map when several keys match, like
+// 1 and "1".
+func mapLookup(m reflect.Value, key interface{}) ([]reflect.Value, error) {
+	if key != nil {
+		kv := reflect.ValueOf(key)
+		if kv.Type().Comparable() && kv.Type().AssignableTo(m.Type().Key()) {
+			if v := m.MapIndex(kv); v.IsValid() {
+				return []reflect.Value{v}, nil
+			}
+		}
+	}
+	var values []reflect.Value
+	iter := m.MapRange()
+	for iter.Next() {
+		ok, err := looseEquality(iter.Key().Interface(), key)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			values = append(values, iter.Value())
+		}
+	}
+	return values, nil
+}
+
 func in(opsym string, inv bool) operator {
 	return operatorFunc(func(left, right interface{}) (bool, error) {
 		rv := reflect.ValueOf(right)
@@ -475,9 +962,9 @@ func like(left, right interface{}) (bool, error) {
 		pleft = ""
 		sr = sr[1:]
 	}
-	if sr[len(sr)-1] == '*' {
+	if len(sr) > 0 && sr[len(sr)-1] == '*' {
 		pright = ""
-		sr = sr[0 : len(sr)-2]
+		sr = sr[:len(sr)-1]
 	}
 	patstring := "(?i)" + pleft + regexp.QuoteMeta(sr) + pright
 	r, ok := rcache.find(patstring)
@@ -628,6 +1115,14 @@ func boolstringequal(a bool, b string) bool {
 	}
 }
 
+func isnumber(n interface{}) bool {
+	switch n.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return true
+	}
+	return false
+}
+
 func numbertofloat64(n interface{}) float64 {
 	switch _n := n.(type) {
 	case int:
@@ -372,6 +372,260 @@ func TestDifferenceOperator(t *testing.T) {
 	})
 }
 
+func TestSupersetOperator(t *testing.T) {
+	t.Parallel()
+	r := testResource{
+		rtype: "zone",
+		attributes: map[string]interface{}{
+			"tags":     []string{"prod", "eu", "prod", "managed"},
+			"required": []interface{}{"eu", "prod"},
+			"plan":     "enterprise",
+		},
+	}
+	t.Run("should return true when left contains every element of right", func(t *testing.T) {
+		ok, err := Cond("@tags", "$superset", []interface{}{"managed", "eu", "eu"}).evaluate(r)
+		assertNilError(t, err)
+		assertOkay(t, ok)
+	})
+	t.Run("should return false when left is missing an element of right", func(t *testing.T) {
+		ok, err := Cond("@tags", "$superset", []string{"eu", "us"}).evaluate(r)
+		assertNilError(t, err)
+		assertNotOkay(t, ok)
+	})
+	t.Run("should return true when right is empty", func(t *testing.T) {
+		ok, err := Cond("@tags", "$superset", []string{}).evaluate(r)
+		assertNilError(t, err)
+		assertOkay(t, ok)
+	})
+	t.Run("should accept attribute references on both sides", func(t *testing.T) {
+		ok, err := Cond("@tags", "$superset", "@required").evaluate(r)
+		assertNilError(t, err)
+		assertOkay(t, ok)
+	})
+	t.Run("should return err when left operand is not array-ish", func(t *testing.T) {
+		_, err := Cond("@plan", "$superset", []string{"enterprise"}).evaluate(r)
+		assertError(t, err)
+	})
+	t.Run("should return err when right operand is not array-ish", func(t *testing.T) {
+		_, err := Cond("@tags", "$superset", "@plan").evaluate(r)
+		assertError(t, err)
+	})
+}
+
+func TestSubsetOperator(t *testing.T) {
+	t.Parallel()
+	r := testResource{
+		rtype: "zone",
+		attributes: map[string]interface{}{
+			"ids":     []int{1, 2, 2},
+			"allowed": []interface{}{"1", "2", float64(3)},
+			"plan":    "pro",
+		},
+	}
+	t.Run("should return true when every element of left is in right", func(t *testing.T) {
+		ok, err := Cond("@ids", "$subset", []interface{}{3, "2", 1.0}).evaluate(r)
+		assertNilError(t, err)
+		assertOkay(t, ok)
+	})
+	t.Run("should return false when left has an element not in right", func(t *testing.T) {
+		ok, err := Cond("@ids", "$subset", []int{1, 3}).evaluate(r)
+		assertNilError(t, err)
+		assertNotOkay(t, ok)
+	})
+	t.Run("should return true when left is empty", func(t *testing.T) {
+		ok, err := Cond([]string{}, "$subset", "@allowed").evaluate(r)
+		assertNilError(t, err)
+		assertOkay(t, ok)
+	})
+	t.Run("should accept attribute references on both sides", func(t *testing.T) {
+		ok, err := Cond("@ids", "$subset", "@allowed").evaluate(r)
+		assertNilError(t, err)
+		assertOkay(t, ok)
+	})
+	t.Run("should return err when left operand is not array-ish", func(t *testing.T) {
+		_, err := Cond("@plan", "$subset", []string{"pro"}).evaluate(r)
+		assertError(t, err)
+	})
+	t.Run("should return err when right operand is not array-ish", func(t *testing.T) {
+		_, err := Cond("@ids", "$subset", "@plan").evaluate(r)
+		assertError(t, err)
+	})
+}
+
+func TestSetEqualityOperator(t *testing.T) {
+	t.Parallel()
+	r := testResource{
+		rtype: "zone",
+		attributes: map[string]interface{}{
+			"tags":  []string{"b", "a", "a"},
+			"other": []string{"a", "b"},
+			"plan":  "free",
+		},
+	}
+	t.Run("should ignore ordering and duplicates", func(t *testing.T) {
+		ok, err := Cond("@tags", "$seteq", []interface{}{"a", "b", "b"}).evaluate(r)
+		assertNilError(t, err)
+		assertOkay(t, ok)
+	})
+	t.Run("should return false when right is a strict superset", func(t *testing.T) {
+		ok, err := Cond("@tags", "$seteq", []string{"a", "b", "c"}).evaluate(r)
+		assertNilError(t, err)
+		assertNotOkay(t, ok)
+	})
+	t.Run("should return false when right is a strict subset", func(t *testing.T) {
+		ok, err := Cond("@tags", "$seteq", []string{"a"}).evaluate(r)
+		assertNilError(t, err)
+		assertNotOkay(t, ok)
+	})
+	t.Run("should accept attribute references on both sides", func(t *testing.T) {
+		ok, err := Cond("@other", "$seteq", "@tags").evaluate(r)
+		assertNilError(t, err)
+		assertOkay(t, ok)
+	})
+	t.Run("should return err when an operand is not array-ish", func(t *testing.T) {
+		_, err := Cond("@plan", "$seteq", "@tags").evaluate(r)
+		assertError(t, err)
+	})
+}
+
+func TestLengthOperator(t *testing.T) {
+	t.Parallel()
+	r := testResource{
+		rtype: "group",
+		attributes: map[string]interface{}{
+			"members": []string{"ann", "bob", "cat"},
+			"labels":  map[string]string{"env": "prod"},
+			"name":    "admins",
+		},
+	}
+	t.Run("should compare length for equality with a plain number", func(t *testing.T) {
+		ok, err := Cond("@members", "$len", 3).evaluate(r)
+		assertNilError(t, err)
+		assertOkay(t, ok)
+	})
+	t.Run("should use the comparison when given a pair", func(t *testing.T) {
+		ok, err := Cond("@members", "$len", []interface{}{">=", float64(2)}).evaluate(r)
+		assertNilError(t, err)
+		assertOkay(t, ok)
+		ok, err = Cond("@members", "$len", []interface{}{"<", 3}).evaluate(r)
+		assertNilError(t, err)
+		assertNotOkay(t, ok)
+	})
+	t.Run("should measure maps", func(t *testing.T) {
+		ok, err := Cond("@labels", "$len", []interface{}{"!=", 0}).evaluate(r)
+		assertNilError(t, err)
+		assertOkay(t, ok)
+	})
+	t.Run("should treat missing attributes as empty", func(t *testing.T) {
+		ok, err := Cond("@nope", "$len", 0).evaluate(r)
+		assertNilError(t, err)
+		assertOkay(t, ok)
+	})
+	t.Run("should return err when left operand is not a collection", func(t *testing.T) {
+		_, err := Cond("@name", "$len", 6).evaluate(r)
+		assertError(t, err)
+	})
+	t.Run("should return err for an unknown comparison", func(t *testing.T) {
+		_, err := Cond("@members", "$len", []interface{}{"~", 1}).evaluate(r)
+		assertError(t, err)
+	})
+	t.Run("should return err for a non-numeric length", func(t *testing.T) {
+		_, err := Cond("@members", "$len", "3").evaluate(r)
+		assertError(t, err)
+	})
+}
+
+func TestHasKeyOperator(t *testing.T) {
+	t.Parallel()
+	r := testResource{
+		rtype: "zone",
+		attributes: map[string]interface{}{
+			"labels": map[string]interface{}{"env": "prod", "team": "dns"},
+			"ports":  map[int]bool{443: true},
+			"name":   "example.com",
+		},
+	}
+	t.Run("should return true when the key is present", func(t *testing.T) {
+		ok, err := Cond("@labels", "$haskey", "team").evaluate(r)
+		assertNilError(t, err)
+		assertOkay(t, ok)
+	})
+	t.Run("should return false when the key is absent", func(t *testing.T) {
+		ok, err := Cond("@labels", "$haskey", "owner").evaluate(r)
+		assertNilError(t, err)
+		assertNotOkay(t, ok)
+	})
+	t.Run("should loosely match non-string keys", func(t *testing.T) {
+		ok, err := Cond("@ports", "$haskey", float64(443)).evaluate(r)
+		assertNilError(t, err)
+		assertOkay(t, ok)
+	})
+	t.Run("should return false for missing attributes", func(t *testing.T) {
+		ok, err := Cond("@nope", "$haskey", "env").evaluate(r)
+		assertNilError(t, err)
+		assertNotOkay(t, ok)
+	})
+	t.Run("should return err when left operand is not a map", func(t *testing.T) {
+		_, err := Cond("@name", "$haskey", "env").evaluate(r)
+		assertError(t, err)
+	})
+}
+
+func TestHasEntryOperator(t *testing.T) {
+	t.Parallel()
+	r := testResource{
+		rtype: "zone",
+		attributes: map[string]interface{}{
+			"labels": map[string]interface{}{"env": "prod", "tier": 1},
+			"tags":   []string{"env"},
+		},
+	}
+	t.Run("should return true when the entry is present", func(t *testing.T) {
+		ok, err := Cond("@labels", "$hasentry", map[string]interface{}{"env": "prod"}).evaluate(r)
+		assertNilError(t, err)
+		assertOkay(t, ok)
+	})
+	t.Run("should require every entry", func(t *testing.T) {
+		ok, err := Cond("@labels", "$hasentry", map[string]interface{}{"env": "prod", "tier": "1"}).evaluate(r)
+		assertNilError(t, err)
+		assertOkay(t, ok)
+		ok, err = Cond("@labels", "$hasentry", map[string]interface{}{"env": "prod", "tier": 2}).evaluate(r)
+		assertNilError(t, err)
+		assertNotOkay(t, ok)
+	})
+	t.Run("should return false when the value differs", func(t *testing.T) {
+		ok, err := Cond("@labels", "$hasentry", map[string]string{"env": "dev"}).evaluate(r)
+		assertNilError(t, err)
+		assertNotOkay(t, ok)
+	})
+	t.Run("should return false when the key is absent", func(t *testing.T) {
+		ok, err := Cond("@labels", "$hasentry", map[string]string{"owner": "dns"}).evaluate(r)
+		assertNilError(t, err)
+		assertNotOkay(t, ok)
+	})
+	t.Run("should prefer keys of the same type when several keys match", func(t *testing.T) {
+		r := testResource{rtype: "zone", attributes: map[string]interface{}{
+			"ids": map[interface{}]interface{}{1: "int", "1": "string"},
+		}}
+		// repeated, since the iteration order of maps is random
+		for i := 0; i < 50; i++ {
+			for entry, want := range map[interface{}]bool{"1": true, 1: false, float64(1): true} {
+				ok, err := Cond("@ids", "$hasentry", map[interface{}]interface{}{entry: "string"}).evaluate(r)
+				assertNilError(t, err)
+				require.Equal(t, want, ok, "%T key", entry)
+			}
+		}
+	})
+	t.Run("should return err when left operand is not a map", func(t *testing.T) {
+		_, err := Cond("@tags", "$hasentry", map[string]string{"env": "prod"}).evaluate(r)
+		assertError(t, err)
+	})
+	t.Run("should return err when right operand is not a map", func(t *testing.T) {
+		_, err := Cond("@labels", "$hasentry", "env=prod").evaluate(r)
+		assertError(t, err)
+	})
+}
+
 func assertError(t *testing.T, err error) {
 	t.Helper()
 	if err == nil {
@@ -425,6 +679,22 @@ func TestLikeOperator(t *testing.T) {
 			t.Errorf("test failed")
 		}
 	})
+	t.Run("should keep the character before a trailing wildcard", func(t *testing.T) {
+		ok, err := Cond("@tag", "~=", "wish_lisp*").evaluate(tr)
+		if err != nil {
+			t.Errorf("test failed with unexpected error: %s", err)
+		} else if ok {
+			t.Errorf("test failed")
+		}
+	})
+	t.Run("should match anything with a lone wildcard", func(t *testing.T) {
+		ok, err := Cond("@tag", "~=", "*").evaluate(tr)
+		if err != nil {
+			t.Errorf("test failed with unexpected error: %s", err)
+		} else if !ok {
+			t.Errorf("test failed")
+		}
+	})
 }
 
 type testSubject struct {
@@ -641,3 +911,85 @@ func TestCan(t *testing.T) {
 		})
 	}
 }
+
+func TestCanWithEnv(t *testing.T) {
+	actor := testSubject{
+		rules: []*Rule{
+			new(Rule).Access(Allow).Where(
+				Action("delete"),
+				ResourceType("zone"),
+				ResourceMatch(
+					Cond("$env.mfa", "=", true),
+					Cond("@owner", "=", "$env.account"),
+				),
+			),
+		},
+	}
+	resource := testResource{
+		rtype:      "zone",
+		attributes: map[string]interface{}{"owner": "acct-1"},
+	}
+	t.Run("should resolve $env. references from the environment", func(t *testing.T) {
+		ok, err := CanWithEnv(actor, "delete", resource, Env{"mfa": true, "account": "acct-1"})
+		require.Nil(t, err)
+		require.True(t, ok)
+	})
+	t.Run("should treat missing environment values as nil", func(t *testing.T) {
+		ok, err := CanWithEnv(actor, "delete", resource, Env{"account": "acct-1"})
+		require.Nil(t, err)
+		require.False(t, ok)
+	})
+	t.Run("should treat $env. references as nil without an environment", func(t *testing.T) {
+		ok, err := Can(actor, "delete", resource)
+		require.Nil(t, err)
+		require.False(t, ok)
+	})
+	t.Run("should return errors from the environment", func(t *testing.T) {
+		_, err := CanWithEnv(actor, "delete", resource, errEnv{})
+		require.NotNil(t, err)
+	})
+	t.Run("should allow escaping the $env. prefix", func(t *testing.T) {
+		ok, err := Cond("$env.mfa", "=", `\$env.mfa`).evaluate(envResource{
+			Resource: resource,
+			env:      Env{"mfa": "$env.mfa"},
+		})
+		require.Nil(t, err)
+		require.True(t, ok)
+	})
+}
+
+type errEnv struct{}
+
+func (errEnv) GetEnvironmentValue(string) (interface{}, error) {
+	return nil, errors.New("environment unavailable")
+}
+
+func TestRuleIntrospection(t *testing.T) {
+	meta := map[string]interface{}{"owner": "dns-team"}
+	r := new(Rule).
+		Access(Deny).
+		Meta(meta).
+		Where(
+			Not(Action("delete", "update")),
+			ResourceType("*"),
+			ResourceMatch(Cond("@locked", "=", true)),
+		)
+	require.Equal(t, Deny, r.GetAccess())
+	require.Equal(t, meta, r.GetMeta())
+	require.Equal(t, Blocklist, r.Actions().Mode())
+	require.Equal(t, []string{"delete", "update"}, r.Actions().Elements())
+	require.Equal(t, Wildcard, r.ResourceTypes().Mode())
+	require.Equal(t, []string{}, r.ResourceTypes().Elements())
+	require.Equal(t, "$and", r.Conditions().Conjunction())
+	evals := r.Conditions().Evaluators()
+	require.Len(t, evals, 1)
+	c, ok := evals[0].(Condition)
+	require.True(t, ok)
+	require.Equal(t, "@locked", c.Left())
+	require.Equal(t, "=", c.Operator())
+	require.Equal(t, true, c.Right())
+
+	// accessors must not leak internal state
+	r.Actions().Elements()[0] = "read"
+	require.Equal(t, []string{"delete", "update"}, r.Actions().Elements())
+}
@@ -0,0 +1,81 @@
+package authrsql
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Dialect renders the parts of a WHERE clause that differ between databases.
+type Dialect interface {
+	// Placeholder returns the bind parameter for the nth argument of the
+	// query, starting at 1.
+	Placeholder(n int) string
+
+	// ILike returns a case-insensitive LIKE of expr against pattern, which
+	// is the placeholder of an already lowercased pattern that uses "!" as
+	// its escape character.
+	ILike(expr, pattern string) string
+
+	// Regexp returns a regular expression match of expr against pattern,
+	// which is a placeholder. It returns an error if the database does not
+	// support regular expressions.
+	Regexp(expr, pattern string, caseInsensitive bool) (string, error)
+}
+
+type postgres struct{}
+
+// Postgres is the Dialect for PostgreSQL.
+var Postgres Dialect = postgres{}
+
+func (postgres) Placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+func (postgres) ILike(expr, pattern string) string {
+	return fmt.Sprintf("%s ILIKE %s ESCAPE '!'", expr, pattern)
+}
+
+func (postgres) Regexp(expr, pattern string, caseInsensitive bool) (string, error) {
+	if caseInsensitive {
+		return fmt.Sprintf("%s ~* %s", expr, pattern), nil
+	}
+	return fmt.Sprintf("%s ~ %s", expr, pattern), nil
+}
+
+type mysql struct{}
+
+// MySQL is the Dialect for MySQL 8.0 and later.
+var MySQL Dialect = mysql{}
+
+func (mysql) Placeholder(n int) string {
+	return "?"
+}
+
+func (mysql) ILike(expr, pattern string) string {
+	return fmt.Sprintf("LOWER(%s) LIKE %s ESCAPE '!'", expr, pattern)
+}
+
+func (mysql) Regexp(expr, pattern string, caseInsensitive bool) (string, error) {
+	if caseInsensitive {
+		return fmt.Sprintf("REGEXP_LIKE(%s, %s, 'i')", expr, pattern), nil
+	}
+	return fmt.Sprintf("REGEXP_LIKE(%s, %s, 'c')", expr, pattern), nil
+}
+
+type sqlite struct{}
+
+// SQLite is the Dialect for SQLite. It does not support regular expressions,
+// since SQLite has no built-in REGEXP function.
+var SQLite Dialect = sqlite{}
+
+func (sqlite) Placeholder(n int) string {
+	return "?"
+}
+
+func (sqlite) ILike(expr, pattern string) string {
+	return fmt.Sprintf("LOWER(%s) LIKE %s ESCAPE '!'", expr, pattern)
+}
+
+func (sqlite) Regexp(expr, pattern string, caseInsensitive bool) (string, error) {
+	return "", fmt.Errorf("authrsql: regular expressions are not supported by SQLite")
+}
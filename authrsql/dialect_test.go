@@ -0,0 +1,60 @@
+package authrsql
+
+import (
+	"testing"
+
+	"github.com/cloudflare/authr/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialects(t *testing.T) {
+	e := authr.Conjunction{
+		authr.Comparison{Left: authr.Attribute("status"), Operator: "=", Right: "open"},
+		authr.Comparison{Left: authr.Attribute("title"), Operator: "~=", Right: "*Hello*"},
+		authr.Comparison{Left: authr.Attribute("title"), Operator: "!~*", Right: "^draft"},
+	}
+	cols := ColumnMap{
+		"status": {Name: `"status"`, Type: String},
+		"title":  {Name: `"title"`, Type: String},
+	}
+	cases := []struct {
+		n      string
+		d      Dialect
+		clause string
+		err    string
+	}{
+		{
+			n:      "should render Postgres",
+			d:      Postgres,
+			clause: `(("status" IS NOT NULL AND "status" = $1) AND ("title" IS NOT NULL AND "title" ILIKE $2 ESCAPE '!') AND NOT ("title" IS NOT NULL AND "title" ~* $3))`,
+		},
+		{
+			n:      "should render MySQL",
+			d:      MySQL,
+			clause: `(("status" IS NOT NULL AND "status" = ?) AND ("title" IS NOT NULL AND LOWER("title") LIKE ? ESCAPE '!') AND NOT ("title" IS NOT NULL AND REGEXP_LIKE("title", ?, 'i')))`,
+		},
+		{
+			n:   "should err on regular expressions in SQLite",
+			d:   SQLite,
+			err: "authrsql: regular expressions are not supported by SQLite",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.n, func(t *testing.T) {
+			clause, args, err := Translator{Dialect: c.d, Columns: cols}.Where(e)
+			if c.err != "" {
+				require.NotNil(t, err)
+				require.Equal(t, c.err, err.Error())
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, c.clause, clause)
+			require.Equal(t, []interface{}{"open", "%hello%", "^draft"}, args)
+		})
+	}
+	t.Run("should render SQLite without regular expressions", func(t *testing.T) {
+		clause, _, err := Translator{Dialect: SQLite, Columns: cols}.Where(e[:2])
+		require.Nil(t, err)
+		require.Equal(t, `(("status" IS NOT NULL AND "status" = ?) AND ("title" IS NOT NULL AND LOWER("title") LIKE ? ESCAPE '!'))`, clause)
+	})
+}
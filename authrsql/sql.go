@@ -0,0 +1,504 @@
+// Package authrsql translates the residual expressions returned from
+// authr.PartialEval into parameterized SQL, so that a query like
+//
+//	SELECT * FROM posts WHERE <clause>
+//
+// returns exactly the rows that authr.Can would allow, without loading any of
+// the others.
+//
+// The translation follows authr's loose equality, where a missing attribute
+// equals the zero value of any type and values of different types are
+// compared through their string representations, by taking the type of each
+// column into account. The operators "=", "!=", "$in", "$nin", "~=" and the
+// regular expression operators are supported; any other operator in the
+// residual expression is an error.
+//
+// The database's collation must compare strings case-sensitively for "=" and
+// "$in" to behave like authr, and regular expressions are passed to the
+// database as written, so they must use syntax that both Go and the database
+// understand.
+package authrsql
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cloudflare/authr/v3"
+)
+
+// Type is the type of the values held by a column.
+type Type int
+
+const (
+	// String columns hold text
+	String Type = iota
+
+	// Number columns hold integers or floating-point numbers
+	Number
+
+	// Bool columns hold booleans
+	Bool
+)
+
+func (t Type) zero() interface{} {
+	switch t {
+	case Number:
+		return float64(0)
+	case Bool:
+		return false
+	}
+	return ""
+}
+
+// Column is the SQL expression holding an attribute of the resource, like a
+// column name, along with the type of its values. A NULL value is treated as
+// a missing attribute. The name is inserted into the query as is, so it must
+// be quoted if needed.
+type Column struct {
+	Name string
+	Type Type
+}
+
+// ColumnMapper maps the attributes of a resource to columns.
+type ColumnMapper interface {
+	Column(attribute string) (Column, error)
+}
+
+// ColumnFunc allows a plain function to be used as a ColumnMapper.
+type ColumnFunc func(attribute string) (Column, error)
+
+func (f ColumnFunc) Column(attribute string) (Column, error) {
+	return f(attribute)
+}
+
+// ColumnMap is a ColumnMapper backed by a map. Attributes not in the map are
+// an error.
+type ColumnMap map[string]Column
+
+func (m ColumnMap) Column(attribute string) (Column, error) {
+	c, ok := m[attribute]
+	if !ok {
+		return Column{}, fmt.Errorf("authrsql: no column for attribute %q", attribute)
+	}
+	return c, nil
+}
+
+// Translator translates residual expressions into WHERE clauses.
+type Translator struct {
+	Dialect Dialect
+	Columns ColumnMapper
+
+	// ArgOffset is the number of arguments already bound elsewhere in the
+	// query, the placeholders of the clause are numbered after them.
+	ArgOffset int
+}
+
+// Where returns the WHERE clause, without the keyword, equivalent to the
+// residual expression along with the arguments for its placeholders.
+func (t Translator) Where(e authr.Expr) (string, []interface{}, error) {
+	n, err := t.translate(e)
+	if err != nil {
+		return "", nil, err
+	}
+	r := &renderer{dialect: t.Dialect, offset: t.ArgOffset}
+	clause, err := n.render(r)
+	if err != nil {
+		return "", nil, err
+	}
+	return clause, r.args, nil
+}
+
+func (t Translator) translate(e authr.Expr) (node, error) {
+	switch e := e.(type) {
+	case authr.Constant:
+		return constNode(e), nil
+	case authr.Conjunction:
+		n, err := t.translateAll(e)
+		return andNode(n), err
+	case authr.Disjunction:
+		n, err := t.translateAll(e)
+		return orNode(n), err
+	case authr.Negation:
+		n, err := t.translate(e.Expr)
+		return notNode{n}, err
+	case authr.Comparison:
+		return t.comparison(e)
+	}
+	return nil, fmt.Errorf("authrsql: unexpected expression %T", e)
+}
+
+func (t Translator) translateAll(exprs []authr.Expr) ([]node, error) {
+	nodes := make([]node, len(exprs))
+	for i, e := range exprs {
+		var err error
+		if nodes[i], err = t.translate(e); err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+func (t Translator) comparison(c authr.Comparison) (node, error) {
+	left, lok := c.Left.(authr.Attribute)
+	right, rok := c.Right.(authr.Attribute)
+	switch c.Operator {
+	case "=", "!=":
+		var (
+			n   node
+			err error
+		)
+		switch {
+		case lok && rok:
+			n, err = t.columnsEqual(left, right)
+		case lok:
+			n, err = t.equal(left, c.Right)
+		default:
+			// loose equality is symmetric
+			n, err = t.equal(right, c.Left)
+		}
+		if err != nil || c.Operator == "=" {
+			return n, err
+		}
+		return notNode{n}, nil
+	case "$in", "$nin":
+		if !lok || rok {
+			return nil, unsupported(c)
+		}
+		rv := reflect.ValueOf(c.Right)
+		if c.Right == nil || (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) {
+			return nil, fmt.Errorf("authrsql: %s operator expects the right operand to be an array or slice, received %T", c.Operator, c.Right)
+		}
+		anyOf := make(orNode, rv.Len())
+		for i := range anyOf {
+			var err error
+			if anyOf[i], err = t.equal(left, rv.Index(i).Interface()); err != nil {
+				return nil, err
+			}
+		}
+		if c.Operator == "$nin" {
+			return notNode{anyOf}, nil
+		}
+		return anyOf, nil
+	case "~=":
+		if !lok || rok {
+			return nil, unsupported(c)
+		}
+		return t.like(left, c.Right)
+	case "~", "~*", "!~", "!~*":
+		if !lok || rok {
+			return nil, unsupported(c)
+		}
+		return t.regexp(left, c.Operator, c.Right)
+	}
+	return nil, unsupported(c)
+}
+
+func unsupported(c authr.Comparison) error {
+	return fmt.Errorf("authrsql: cannot translate %s", c)
+}
+
+func (t Translator) column(attr authr.Attribute) (Column, error) {
+	return t.Columns.Column(string(attr))
+}
+
+// equal matches the rows where authr would find the attribute loosely equal
+// to the value. A NULL column is equal to the zero value of any type, and a
+// non-NULL column is compared with the value converted to the column's type.
+func (t Translator) equal(attr authr.Attribute, v interface{}) (node, error) {
+	col, err := t.column(attr)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		nonNull   node
+		nullEqual bool
+	)
+	switch {
+	case v == nil:
+		nonNull, nullEqual = cmpNode{col: col, v: col.Type.zero()}, true
+	case isString(v):
+		s := v.(string)
+		nullEqual = s == ""
+		switch col.Type {
+		case String:
+			nonNull = cmpNode{col: col, v: s}
+		case Number:
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil || fmt.Sprintf("%v", f) != s {
+				// no number has this string representation
+				nonNull = constNode(false)
+			} else {
+				nonNull = cmpNode{col: col, v: f}
+			}
+		case Bool:
+			nonNull = cmpNode{col: col, v: s != "" && s != "0"}
+		}
+	case isNumber(v):
+		f := reflect.ValueOf(v).Convert(reflect.TypeOf(float64(0))).Float()
+		nullEqual = f == 0
+		switch col.Type {
+		case String:
+			nonNull = cmpNode{col: col, v: fmt.Sprintf("%v", v)}
+		case Number:
+			nonNull = cmpNode{col: col, v: f}
+		case Bool:
+			switch f {
+			case 1:
+				nonNull = cmpNode{col: col, v: true}
+			case 0:
+				nonNull = cmpNode{col: col, v: false}
+			default:
+				nonNull = constNode(false)
+			}
+		}
+	case isBool(v):
+		b := v.(bool)
+		nullEqual = !b
+		switch col.Type {
+		case String:
+			empty := orNode{cmpNode{col: col, v: ""}, cmpNode{col: col, v: "0"}}
+			if b {
+				nonNull = notNode{empty}
+			} else {
+				nonNull = empty
+			}
+		case Number:
+			if b {
+				nonNull = cmpNode{col: col, v: float64(1)}
+			} else {
+				nonNull = cmpNode{col: col, v: float64(0)}
+			}
+		case Bool:
+			nonNull = cmpNode{col: col, v: b}
+		}
+	default:
+		return nil, fmt.Errorf("authrsql: unsupported type in loose equality check: '%T'", v)
+	}
+	if nonNull == nil {
+		return nil, fmt.Errorf("authrsql: unknown type %d for column %s", col.Type, col.Name)
+	}
+	return withNull(col, nullEqual, nonNull), nil
+}
+
+// columnsEqual matches the rows where two attributes of the same type are
+// loosely equal.
+func (t Translator) columnsEqual(left, right authr.Attribute) (node, error) {
+	lcol, err := t.column(left)
+	if err != nil {
+		return nil, err
+	}
+	rcol, err := t.column(right)
+	if err != nil {
+		return nil, err
+	}
+	if lcol.Type != rcol.Type {
+		return nil, fmt.Errorf("authrsql: cannot compare attributes %q and %q of different types", left, right)
+	}
+	return columnsNode{left: lcol, right: rcol}, nil
+}
+
+// like mirrors authr's "~=" operator: a case-insensitive match of the whole
+// value, where a leading or trailing "*" matches anything.
+func (t Translator) like(attr authr.Attribute, v interface{}) (node, error) {
+	col, err := t.column(attr)
+	if err != nil {
+		return nil, err
+	}
+	if col.Type != String {
+		return nil, fmt.Errorf("authrsql: cannot translate ~= on non-string attribute %q", attr)
+	}
+	p, ok := v.(string)
+	if !ok || p == "" {
+		return nil, fmt.Errorf("authrsql: right operand of the like operator (~=) must be a non-empty string")
+	}
+	prefix, suffix := "", ""
+	anchors := [2]string{"^", "$"}
+	if p[0] == '*' {
+		prefix, anchors[0] = "%", ""
+		p = p[1:]
+	}
+	if len(p) > 0 && p[len(p)-1] == '*' {
+		suffix, anchors[1] = "%", ""
+		p = p[:len(p)-1]
+	}
+	escaped := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(strings.ToLower(p))
+	re := regexp.MustCompile("(?i)" + anchors[0] + regexp.QuoteMeta(p) + anchors[1])
+	return withNull(col, re.MatchString(nilString), likeNode{col: col, pattern: prefix + escaped + suffix}), nil
+}
+
+// regexp mirrors authr's regular expression operators.
+func (t Translator) regexp(attr authr.Attribute, op string, v interface{}) (node, error) {
+	col, err := t.column(attr)
+	if err != nil {
+		return nil, err
+	}
+	if col.Type != String {
+		return nil, fmt.Errorf("authrsql: cannot translate %s on non-string attribute %q", op, attr)
+	}
+	p, ok := v.(string)
+	if !ok || p == "" {
+		return nil, fmt.Errorf("authrsql: right operand of the %s operator must be a non-empty string", op)
+	}
+	ci := strings.HasSuffix(op, "*")
+	goPattern := p
+	if ci {
+		goPattern = "(?i)" + p
+	}
+	re, err := regexp.Compile(goPattern)
+	if err != nil {
+		return nil, err
+	}
+	var n node = withNull(col, re.MatchString(nilString), regexpNode{col: col, pattern: p, ci: ci})
+	if strings.HasPrefix(op, "!") {
+		n = notNode{n}
+	}
+	return n, nil
+}
+
+// nilString is how authr formats a missing attribute when matching it against
+// a pattern.
+const nilString = "<nil>"
+
+// withNull combines the condition for non-NULL values of the column with
+// whether a NULL value matches, so that the result is never NULL itself and
+// can safely be negated.
+func withNull(col Column, nullMatches bool, nonNull node) node {
+	if nullMatches {
+		return orNode{nullNode{col: col}, nonNull}
+	}
+	return andNode{notNode{nullNode{col: col}}, nonNull}
+}
+
+func isString(v interface{}) bool {
+	_, ok := v.(string)
+	return ok
+}
+
+func isBool(v interface{}) bool {
+	_, ok := v.(bool)
+	return ok
+}
+
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return true
+	}
+	return false
+}
+
+// node is the SQL expression tree a residual expression is translated into
+// before being rendered.
+type node interface {
+	render(r *renderer) (string, error)
+}
+
+type renderer struct {
+	dialect Dialect
+	offset  int
+	args    []interface{}
+}
+
+func (r *renderer) bind(v interface{}) string {
+	r.args = append(r.args, v)
+	return r.dialect.Placeholder(r.offset + len(r.args))
+}
+
+type (
+	constNode bool
+	andNode   []node
+	orNode    []node
+	notNode   struct{ n node }
+
+	// nullNode is "col IS NULL"
+	nullNode struct{ col Column }
+
+	// cmpNode is "col = v"
+	cmpNode struct {
+		col Column
+		v   interface{}
+	}
+
+	// columnsNode is "COALESCE(left, zero) = COALESCE(right, zero)"
+	columnsNode struct{ left, right Column }
+
+	// likeNode is a case-insensitive LIKE of a column against a pattern
+	likeNode struct {
+		col     Column
+		pattern string
+	}
+
+	// regexpNode is a regular expression match of a column
+	regexpNode struct {
+		col     Column
+		pattern string
+		ci      bool
+	}
+)
+
+func (c constNode) render(*renderer) (string, error) {
+	if c {
+		return "1=1", nil
+	}
+	return "1=0", nil
+}
+
+func (a andNode) render(r *renderer) (string, error) {
+	if len(a) == 0 {
+		return constNode(true).render(r)
+	}
+	return renderJoined(r, a, " AND ")
+}
+
+func (o orNode) render(r *renderer) (string, error) {
+	if len(o) == 0 {
+		return constNode(false).render(r)
+	}
+	return renderJoined(r, o, " OR ")
+}
+
+func renderJoined(r *renderer, nodes []node, sep string) (string, error) {
+	parts := make([]string, len(nodes))
+	for i, n := range nodes {
+		var err error
+		if parts[i], err = n.render(r); err != nil {
+			return "", err
+		}
+	}
+	return "(" + strings.Join(parts, sep) + ")", nil
+}
+
+func (n notNode) render(r *renderer) (string, error) {
+	if null, ok := n.n.(nullNode); ok {
+		return null.col.Name + " IS NOT NULL", nil
+	}
+	s, err := n.n.render(r)
+	if err != nil {
+		return "", err
+	}
+	return "NOT " + s, nil
+}
+
+func (n nullNode) render(*renderer) (string, error) {
+	return n.col.Name + " IS NULL", nil
+}
+
+func (c cmpNode) render(r *renderer) (string, error) {
+	return c.col.Name + " = " + r.bind(c.v), nil
+}
+
+func (c columnsNode) render(r *renderer) (string, error) {
+	zero := c.left.Type.zero()
+	return fmt.Sprintf("COALESCE(%s, %s) = COALESCE(%s, %s)", c.left.Name, r.bind(zero), c.right.Name, r.bind(zero)), nil
+}
+
+func (l likeNode) render(r *renderer) (string, error) {
+	return r.dialect.ILike(l.col.Name, r.bind(l.pattern)), nil
+}
+
+func (re regexpNode) render(r *renderer) (string, error) {
+	return r.dialect.Regexp(re.col.Name, r.bind(re.pattern), re.ci)
+}
@@ -0,0 +1,329 @@
+package authrsql
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/authr/v3"
+	"github.com/cloudflare/authr/v3/authrutil"
+	"github.com/stretchr/testify/require"
+)
+
+type tri int
+
+const (
+	sqlFalse tri = iota
+	sqlTrue
+	sqlNull
+)
+
+func triOf(b bool) tri {
+	if b {
+		return sqlTrue
+	}
+	return sqlFalse
+}
+
+// eval evaluates the SQL expression tree against a row the way a database
+// would, with three-valued logic for NULL values.
+func eval(t *testing.T, n node, row map[string]interface{}) tri {
+	switch n := n.(type) {
+	case constNode:
+		return triOf(bool(n))
+	case andNode:
+		result := sqlTrue
+		for _, x := range n {
+			switch eval(t, x, row) {
+			case sqlFalse:
+				return sqlFalse
+			case sqlNull:
+				result = sqlNull
+			}
+		}
+		return result
+	case orNode:
+		result := sqlFalse
+		for _, x := range n {
+			switch eval(t, x, row) {
+			case sqlTrue:
+				return sqlTrue
+			case sqlNull:
+				result = sqlNull
+			}
+		}
+		return result
+	case notNode:
+		switch eval(t, n.n, row) {
+		case sqlTrue:
+			return sqlFalse
+		case sqlFalse:
+			return sqlTrue
+		}
+		return sqlNull
+	case nullNode:
+		return triOf(row[n.col.Name] == nil)
+	case cmpNode:
+		v := row[n.col.Name]
+		if v == nil {
+			return sqlNull
+		}
+		return triOf(sqlEqual(v, n.v))
+	case columnsNode:
+		l, r := row[n.left.Name], row[n.right.Name]
+		if l == nil {
+			l = n.left.Type.zero()
+		}
+		if r == nil {
+			r = n.right.Type.zero()
+		}
+		return triOf(sqlEqual(l, r))
+	case likeNode:
+		v := row[n.col.Name]
+		if v == nil {
+			return sqlNull
+		}
+		return triOf(likeRegexp(n.pattern).MatchString(strings.ToLower(v.(string))))
+	case regexpNode:
+		v := row[n.col.Name]
+		if v == nil {
+			return sqlNull
+		}
+		p := n.pattern
+		if n.ci {
+			p = "(?i)" + p
+		}
+		return triOf(regexp.MustCompile(p).MatchString(v.(string)))
+	}
+	t.Fatalf("unexpected node: %T", n)
+	return sqlNull
+}
+
+func sqlEqual(a, b interface{}) bool {
+	if isNumber(a) && isNumber(b) {
+		return fmt.Sprintf("%v", a) == fmt.Sprintf("%v", b)
+	}
+	return a == b
+}
+
+// likeRegexp converts a LIKE pattern escaped with "!" to a regular expression.
+func likeRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?s)^")
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '!':
+			escaped = true
+		case r == '%':
+			b.WriteString(".*")
+		case r == '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+var columns = ColumnMap{
+	"title":     {Name: "title", Type: String},
+	"status":    {Name: "status", Type: String},
+	"author_id": {Name: "author_id", Type: Number},
+	"score":     {Name: "score", Type: Number},
+	"public":    {Name: "public", Type: Bool},
+}
+
+var conditions = []authr.Evaluator{
+	authr.Cond("@author_id", "=", 1),
+	authr.Cond("@author_id", "=", float64(1)),
+	authr.Cond("@author_id", "=", "1"),
+	authr.Cond("@author_id", "=", "1.0"),
+	authr.Cond("@author_id", "!=", 0),
+	authr.Cond("@author_id", "=", nil),
+	authr.Cond("@author_id", "=", true),
+	authr.Cond(2, "=", "@author_id"),
+	authr.Cond("@author_id", "$in", []interface{}{1, "2"}),
+	authr.Cond("@author_id", "=", "@score"),
+	authr.Cond("@score", "!=", 1.5),
+	authr.Cond("@status", "$nin", []interface{}{"draft", nil}),
+	authr.Cond("@status", "$in", []interface{}{}),
+	authr.Cond("@status", "=", false),
+	authr.Cond("@status", "=", true),
+	authr.Cond("@status", "=", nil),
+	authr.Cond("@status", "=", 1),
+	authr.Cond("@status", "=", "@title"),
+	authr.Cond("@title", "~=", "hello*"),
+	authr.Cond("@title", "~=", "*world"),
+	authr.Cond("@title", "~=", "*_*"),
+	authr.Cond("@title", "~=", "100%"),
+	authr.Cond("@title", "~=", "*nil*"),
+	authr.Cond("@title", "~*", "^h.*o$"),
+	authr.Cond("@title", "!~", "World"),
+	authr.Cond("@title", "!~*", "nil"),
+	authr.Cond("@public", "=", true),
+	authr.Cond("@public", "=", "0"),
+	authr.Cond("@public", "!=", 1),
+	authr.Cond("@public", "=", 2),
+}
+
+func randomRows(rnd *rand.Rand, n int) []map[string]interface{} {
+	values := map[string][]interface{}{
+		"title":     {nil, "", "0", "1", "Hello World", "hello", "a_b", "100%", "<nil>"},
+		"status":    {nil, "", "0", "1", "draft", "open", "hello"},
+		"author_id": {nil, 0, 1, 2, 1.5},
+		"score":     {nil, 0, 1, 1.5},
+		"public":    {nil, true, false},
+	}
+	rows := make([]map[string]interface{}, n)
+	for i := range rows {
+		rows[i] = map[string]interface{}{}
+		for col, vs := range values {
+			rows[i][col] = vs[rnd.Intn(len(vs))]
+		}
+	}
+	return rows
+}
+
+func randomRules(rnd *rand.Rand) authr.RuleList {
+	rules := make(authr.RuleList, 1+rnd.Intn(5))
+	for i := range rules {
+		access := authr.Allow
+		if rnd.Intn(3) == 0 {
+			access = authr.Deny
+		}
+		cs := make([]authr.Evaluator, rnd.Intn(3))
+		for j := range cs {
+			cs[j] = conditions[rnd.Intn(len(conditions))]
+		}
+		match := authr.ResourceMatch(cs...)
+		if rnd.Intn(2) == 0 {
+			match = authr.ResourceMatch(authr.Or(cs...))
+		}
+		rules[i] = new(authr.Rule).Access(access).Where(authr.Action("read"), authr.ResourceType("post"), match)
+	}
+	return rules
+}
+
+func TestWhereAgreesWithCan(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	rows := randomRows(rnd, 300)
+	algorithms := []authr.CombiningAlgorithm{authr.FirstApplicable, authr.DenyOverrides, authr.PermitOverrides}
+	tr := Translator{Dialect: Postgres, Columns: columns}
+
+	t.Run("should translate every condition", func(t *testing.T) {
+		for _, c := range conditions {
+			s := authr.RuleList{new(authr.Rule).Access(authr.Allow).Where(authr.Action("read"), authr.ResourceType("post"), authr.ResourceMatch(c))}
+			e, err := authr.PartialEval(s, "read", "post", nil)
+			require.Nil(t, err)
+			n, err := tr.translate(e)
+			require.Nil(t, err)
+			for _, row := range rows {
+				want, err := authr.Can(s, "read", authrutil.MapResource("post", row))
+				require.Nil(t, err)
+				require.Equal(t, triOf(want), eval(t, n, row), "%s for %v", e, row)
+			}
+		}
+	})
+	for i := 0; i < 200; i++ {
+		s := randomRules(rnd)
+		alg := algorithms[i%len(algorithms)]
+		a := authr.NewAuthorizer(authr.WithCombiningAlgorithm(alg))
+		t.Run(fmt.Sprintf("should return the rows allowed by Can for random rules %d under %s", i, alg), func(t *testing.T) {
+			e, err := a.PartialEval(s, "read", "post", nil)
+			require.Nil(t, err)
+			n, err := tr.translate(e)
+			require.Nil(t, err)
+			_, _, err = tr.Where(e)
+			require.Nil(t, err)
+			for _, row := range rows {
+				want, err := a.Can(s, "read", authrutil.MapResource("post", row))
+				require.Nil(t, err)
+				// a row is only returned if the clause is true, never NULL
+				require.Equal(t, triOf(want), eval(t, n, row), "%s for %v", e, row)
+			}
+		})
+	}
+}
+
+func TestWhere(t *testing.T) {
+	tr := Translator{Dialect: Postgres, Columns: columns}
+	where := func(e authr.Expr) (string, []interface{}, error) {
+		return tr.Where(e)
+	}
+	t.Run("should render parameterized clauses", func(t *testing.T) {
+		clause, args, err := where(authr.Disjunction{
+			authr.Conjunction{
+				authr.Negation{Expr: authr.Comparison{Left: authr.Attribute("public"), Operator: "=", Right: false}},
+				authr.Comparison{Left: authr.Attribute("author_id"), Operator: "$in", Right: []interface{}{1, 2}},
+			},
+			authr.Comparison{Left: authr.Attribute("title"), Operator: "~=", Right: "100%*"},
+		})
+		require.Nil(t, err)
+		require.Equal(t, "((NOT (public IS NULL OR public = $1) AND ((author_id IS NOT NULL AND author_id = $2) OR (author_id IS NOT NULL AND author_id = $3))) OR (title IS NOT NULL AND title ILIKE $4 ESCAPE '!'))", clause)
+		require.Equal(t, []interface{}{false, float64(1), float64(2), "100!%%"}, args)
+	})
+	t.Run("should number placeholders after the offset", func(t *testing.T) {
+		clause, args, err := Translator{Dialect: Postgres, Columns: columns, ArgOffset: 2}.Where(
+			authr.Comparison{Left: authr.Attribute("status"), Operator: "=", Right: "open"},
+		)
+		require.Nil(t, err)
+		require.Equal(t, "(status IS NOT NULL AND status = $3)", clause)
+		require.Equal(t, []interface{}{"open"}, args)
+	})
+	t.Run("should render constants", func(t *testing.T) {
+		clause, args, err := where(authr.Constant(false))
+		require.Nil(t, err)
+		require.Equal(t, "1=0", clause)
+		require.Nil(t, args)
+	})
+	errs := []struct {
+		n   string
+		e   authr.Expr
+		err string
+	}{
+		{
+			n:   "should err on unsupported operators",
+			e:   authr.Comparison{Left: authr.Attribute("status"), Operator: "&", Right: []interface{}{"a"}},
+			err: `authrsql: cannot translate @status & []interface {}{"a"}`,
+		},
+		{
+			n:   "should err on unknown attributes",
+			e:   authr.Comparison{Left: authr.Attribute("owner"), Operator: "=", Right: 1},
+			err: `authrsql: no column for attribute "owner"`,
+		},
+		{
+			n:   "should err on comparing attributes of different types",
+			e:   authr.Comparison{Left: authr.Attribute("status"), Operator: "=", Right: authr.Attribute("score")},
+			err: `authrsql: cannot compare attributes "status" and "score" of different types`,
+		},
+		{
+			n:   "should err on like with non-string attributes",
+			e:   authr.Comparison{Left: authr.Attribute("score"), Operator: "~=", Right: "1*"},
+			err: `authrsql: cannot translate ~= on non-string attribute "score"`,
+		},
+		{
+			n:   "should err on values in array operands",
+			e:   authr.Comparison{Left: "draft", Operator: "$in", Right: authr.Attribute("status")},
+			err: `authrsql: cannot translate "draft" $in @status`,
+		},
+		{
+			n:   "should err on unsupported types",
+			e:   authr.Comparison{Left: authr.Attribute("status"), Operator: "=", Right: map[string]interface{}{}},
+			err: `authrsql: unsupported type in loose equality check: 'map[string]interface {}'`,
+		},
+	}
+	for _, c := range errs {
+		t.Run(c.n, func(t *testing.T) {
+			_, _, err := where(c.e)
+			require.NotNil(t, err)
+			require.Equal(t, c.err, err.Error())
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package authrutil
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/authr/v3"
+)
+
+// CachedSubjectOption configures a CachedSubject.
+type CachedSubjectOption func(*CachedSubject)
+
+// RulesTTL sets how long rules are considered fresh after they are loaded.
+// The default is one minute.
+func RulesTTL(ttl time.Duration) CachedSubjectOption {
+	return func(c *CachedSubject) {
+		c.ttl = ttl
+	}
+}
+
+// StaleTTL sets how long rules are still returned once they are no longer
+// fresh. During that time the first GetRules reloads them in the background,
+// and if that fails, or the subject panics, the stale rules are still returned. The default is zero,
+// rules are reloaded as soon as they expire and callers wait for them.
+func StaleTTL(ttl time.Duration) CachedSubjectOption {
+	return func(c *CachedSubject) {
+		c.staleTTL = ttl
+	}
+}
+
+// ErrorTTL sets how long an error from the subject is remembered. During that
+// time GetRules returns the error without calling the subject, unless stale
+// rules can be returned instead, which are then not reloaded in the
+// background either. The default is zero, errors are not remembered.
+func ErrorTTL(ttl time.Duration) CachedSubjectOption {
+	return func(c *CachedSubject) {
+		c.errTTL = ttl
+	}
+}
+
+// CacheClock sets the function used to get the current time. The default is
+// time.Now.
+func CacheClock(now func() time.Time) CachedSubjectOption {
+	return func(c *CachedSubject) {
+		c.now = now
+	}
+}
+
+// load is a call to the subject's GetRules that concurrent callers can wait
+// for, so that the subject is only called once at a time.
+type load struct {
+	// gen is the generation of the CachedSubject the load started in
+	gen   uint64
+	done  chan struct{}
+	rules []*authr.Rule
+	err   error
+}
+
+// errLoadPanicked is returned to the callers waiting for a load in which the
+// subject's GetRules panicked.
+var errLoadPanicked = errors.New("authrutil.CachedSubject: the subject panicked retrieving its rules")
+
+// CachedSubject is a subject that remembers the rules of another subject, for
+// subjects whose GetRules is expensive, like one that queries a database. It
+// is safe for concurrent use, and only calls the wrapped subject once at a
+// time. The returned rules are shared between callers and must not be
+// modified.
+//
+// A CachedSubject has the key of the wrapped subject if it is an
+// authr.KeyedSubject, and an empty key otherwise. A CachedSubject wrapping a
+// subject created with authr.Intersect remembers the rules of every member at
+// once. To remember them separately, wrap the members instead.
+type CachedSubject struct {
+	s                     authr.Subject
+	ttl, staleTTL, errTTL time.Duration
+	now                   func() time.Time
+
+	mu sync.Mutex
+	// gen is incremented by Invalidate, so that loads started before are
+	// not remembered
+	gen      uint64
+	rules    []*authr.Rule
+	loaded   bool
+	loadedAt time.Time
+	err      error
+	failedAt time.Time
+	inflight *load
+}
+
+var (
+	_ authr.Subject      = &CachedSubject{}
+	_ authr.KeyedSubject = &CachedSubject{}
+)
+
+// NewCachedSubject returns a CachedSubject in front of the provided subject.
+// This function will panic if the subject is nil, the TTL is not positive or
+// the other durations are negative.
+func NewCachedSubject(s authr.Subject, opts ...CachedSubjectOption) *CachedSubject {
+	if s == nil {
+		panic("authrutil.NewCachedSubject provided with a nil subject")
+	}
+	c := &CachedSubject{s: s, ttl: time.Minute, now: time.Now}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.ttl <= 0 {
+		panic("authrutil.NewCachedSubject provided with a non-positive TTL")
+	}
+	if c.staleTTL < 0 || c.errTTL < 0 {
+		panic("authrutil.NewCachedSubject provided with a negative TTL")
+	}
+	if c.now == nil {
+		panic("authrutil.NewCachedSubject provided with a nil clock")
+	}
+	return c
+}
+
+func (c *CachedSubject) GetRules() ([]*authr.Rule, error) {
+	for {
+		now := c.now()
+		c.mu.Lock()
+		age := now.Sub(c.loadedAt)
+		if c.loaded && age < c.ttl {
+			rules := c.rules
+			c.mu.Unlock()
+			return rules, nil
+		}
+		failing := c.err != nil && now.Sub(c.failedAt) < c.errTTL
+		if c.loaded && age < c.ttl+c.staleTTL {
+			if !failing && c.inflight == nil {
+				l := &load{gen: c.gen, done: make(chan struct{})}
+				c.inflight = l
+				go c.refresh(l)
+			}
+			rules := c.rules
+			c.mu.Unlock()
+			return rules, nil
+		}
+		if failing {
+			err := c.err
+			c.mu.Unlock()
+			return nil, err
+		}
+		l := c.inflight
+		if l == nil {
+			l = &load{gen: c.gen, done: make(chan struct{})}
+			c.inflight = l
+			c.mu.Unlock()
+			c.load(l)
+			return l.rules, l.err
+		}
+		gen := c.gen
+		c.mu.Unlock()
+		<-l.done
+		if l.gen == gen {
+			return l.rules, l.err
+		}
+		// the load started before an invalidation, so its rules may be out
+		// of date: load them again once it is done
+	}
+}
+
+// SubjectKey implements authr.KeyedSubject, returning the key of the wrapped
+// subject, or an empty key if it has none.
+func (c *CachedSubject) SubjectKey() string {
+	if ks, ok := c.s.(authr.KeyedSubject); ok {
+		return ks.SubjectKey()
+	}
+	return ""
+}
+
+// Invalidate forgets the remembered rules and error, so that the next
+// GetRules calls the subject, for example after its rules changed. A call to
+// the subject that is already in progress is waited for, but its result is
+// not remembered.
+func (c *CachedSubject) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.rules, c.loaded, c.err = nil, false, nil
+}
+
+func (c *CachedSubject) load(l *load) {
+	// the waiting callers are released even if the subject panics, and the
+	// panic is remembered like an error
+	l.err = errLoadPanicked
+	panicked := true
+	defer func() {
+		c.mu.Lock()
+		if panicked && c.gen == l.gen {
+			c.err, c.failedAt = errLoadPanicked, c.now()
+		}
+		if c.inflight == l {
+			c.inflight = nil
+		}
+		c.mu.Unlock()
+		close(l.done)
+	}()
+	rules, err := c.s.GetRules()
+	panicked = false
+	now := c.now()
+	c.mu.Lock()
+	if c.gen == l.gen {
+		if err == nil {
+			c.rules, c.loaded, c.loadedAt, c.err = rules, true, now, nil
+		} else {
+			c.err, c.failedAt = err, now
+		}
+	}
+	c.mu.Unlock()
+	l.rules, l.err = rules, err
+}
+
+// refresh is a load in the background, where nobody could recover from the
+// subject panicking: the panic is only remembered, and the stale rules are
+// kept.
+func (c *CachedSubject) refresh(l *load) {
+	defer func() {
+		_ = recover()
+	}()
+	c.load(l)
+}
@@ -0,0 +1,321 @@
+package authrutil
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/authr/v3"
+	"github.com/stretchr/testify/require"
+)
+
+type loadingSubject struct {
+	mu    sync.Mutex
+	calls int
+	rules []*authr.Rule
+	err   error
+	// if set, GetRules blocks until it is closed
+	gate chan struct{}
+	// receives a value for every call to GetRules, if set
+	called chan struct{}
+	// if set, GetRules panics once the gate is closed
+	panics bool
+}
+
+type keyedLoadingSubject struct {
+	*loadingSubject
+	key string
+}
+
+func (s keyedLoadingSubject) SubjectKey() string {
+	return s.key
+}
+
+func (s *loadingSubject) GetRules() ([]*authr.Rule, error) {
+	s.mu.Lock()
+	s.calls++
+	gate, called := s.gate, s.called
+	s.mu.Unlock()
+	if called != nil {
+		called <- struct{}{}
+	}
+	if gate != nil {
+		<-gate
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.panics {
+		panic("boom")
+	}
+	return s.rules, s.err
+}
+
+func (s *loadingSubject) set(rules []*authr.Rule, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules, s.err = rules, err
+}
+
+func (s *loadingSubject) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func TestCachedSubject(t *testing.T) {
+	v1 := []*authr.Rule{new(authr.Rule).Access(authr.Allow).Where(authr.Action("read"), authr.ResourceType("zone"), authr.ResourceMatch())}
+	v2 := []*authr.Rule{new(authr.Rule).Access(authr.Deny).Where(authr.Action("read"), authr.ResourceType("zone"), authr.ResourceMatch())}
+	boom := errors.New("boom")
+	var (
+		mu  sync.Mutex
+		now = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	)
+	clock := CacheClock(func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	})
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+	// waitFor polls until the subject was called n times and the resulting
+	// load is remembered
+	waitFor := func(c *CachedSubject, s *loadingSubject, n int) {
+		require.Eventually(t, func() bool {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return s.count() == n && c.inflight == nil
+		}, time.Second, time.Millisecond)
+	}
+
+	t.Run("should remember rules until they expire", func(t *testing.T) {
+		s := &loadingSubject{rules: v1}
+		c := NewCachedSubject(s, clock, RulesTTL(time.Minute))
+		for i := 0; i < 3; i++ {
+			rules, err := c.GetRules()
+			require.Nil(t, err)
+			require.Equal(t, v1, rules)
+		}
+		require.Equal(t, 1, s.count())
+
+		s.set(v2, nil)
+		advance(time.Minute)
+		rules, err := c.GetRules()
+		require.Nil(t, err)
+		require.Equal(t, v2, rules)
+		require.Equal(t, 2, s.count())
+	})
+	t.Run("should only call the subject once for concurrent callers", func(t *testing.T) {
+		s := &loadingSubject{rules: v1, gate: make(chan struct{}), called: make(chan struct{}, 10)}
+		c := NewCachedSubject(s, clock)
+		var wg sync.WaitGroup
+		results := make([][]*authr.Rule, 10)
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				rules, err := c.GetRules()
+				require.Nil(t, err)
+				results[i] = rules
+			}(i)
+		}
+		<-s.called
+		time.Sleep(10 * time.Millisecond)
+		close(s.gate)
+		wg.Wait()
+		require.Equal(t, 1, s.count())
+		for _, rules := range results {
+			require.Equal(t, v1, rules)
+		}
+	})
+	t.Run("should return stale rules while reloading them in the background", func(t *testing.T) {
+		s := &loadingSubject{rules: v1}
+		c := NewCachedSubject(s, clock, RulesTTL(time.Minute), StaleTTL(time.Minute))
+		_, err := c.GetRules()
+		require.Nil(t, err)
+
+		s.set(v2, nil)
+		advance(90 * time.Second)
+		rules, err := c.GetRules()
+		require.Nil(t, err)
+		require.Equal(t, v1, rules)
+		waitFor(c, s, 2)
+		rules, err = c.GetRules()
+		require.Nil(t, err)
+		require.Equal(t, v2, rules)
+		require.Equal(t, 2, s.count())
+
+		s.set(nil, boom)
+		advance(90 * time.Second)
+		rules, err = c.GetRules()
+		require.Nil(t, err)
+		require.Equal(t, v2, rules)
+		waitFor(c, s, 3)
+		rules, err = c.GetRules()
+		require.Nil(t, err)
+		require.Equal(t, v2, rules, "stale rules should be returned if reloading fails")
+		waitFor(c, s, 4)
+
+		advance(time.Minute)
+		_, err = c.GetRules()
+		require.Equal(t, boom, err, "rules should not be returned once the stale TTL is over")
+	})
+	t.Run("should only remember errors for the error TTL", func(t *testing.T) {
+		s := &loadingSubject{err: boom}
+		c := NewCachedSubject(s, clock, ErrorTTL(10*time.Second))
+		for i := 0; i < 2; i++ {
+			_, err := c.GetRules()
+			require.Equal(t, boom, err)
+		}
+		require.Equal(t, 1, s.count())
+
+		s.set(v1, nil)
+		advance(10 * time.Second)
+		rules, err := c.GetRules()
+		require.Nil(t, err)
+		require.Equal(t, v1, rules)
+
+		c = NewCachedSubject(&loadingSubject{err: boom}, clock)
+		for i := 0; i < 2; i++ {
+			_, err := c.GetRules()
+			require.Equal(t, boom, err)
+		}
+		require.Equal(t, 2, c.s.(*loadingSubject).count(), "errors should not be remembered by default")
+	})
+	t.Run("should not reload stale rules in the background while failing", func(t *testing.T) {
+		s := &loadingSubject{rules: v1}
+		c := NewCachedSubject(s, clock, RulesTTL(time.Minute), StaleTTL(time.Minute), ErrorTTL(20*time.Second))
+		_, err := c.GetRules()
+		require.Nil(t, err)
+		s.set(nil, boom)
+		advance(70 * time.Second)
+		_, err = c.GetRules()
+		require.Nil(t, err)
+		waitFor(c, s, 2)
+		for i := 0; i < 3; i++ {
+			rules, err := c.GetRules()
+			require.Nil(t, err)
+			require.Equal(t, v1, rules)
+		}
+		require.Equal(t, 2, s.count())
+	})
+	t.Run("should call the subject again once invalidated", func(t *testing.T) {
+		s := &loadingSubject{rules: v1}
+		c := NewCachedSubject(s, clock, ErrorTTL(time.Minute))
+		_, err := c.GetRules()
+		require.Nil(t, err)
+		s.set(v2, nil)
+		c.Invalidate()
+		rules, err := c.GetRules()
+		require.Nil(t, err)
+		require.Equal(t, v2, rules)
+		require.Equal(t, 2, s.count())
+	})
+	t.Run("should not call the subject again until a call started before an invalidation is done", func(t *testing.T) {
+		s := &loadingSubject{rules: v1, gate: make(chan struct{}), called: make(chan struct{}, 10)}
+		c := NewCachedSubject(s, clock)
+		results := make(chan []*authr.Rule, 2)
+		go func() {
+			rules, _ := c.GetRules()
+			results <- rules
+		}()
+		<-s.called
+		c.Invalidate()
+		go func() {
+			rules, _ := c.GetRules()
+			results <- rules
+		}()
+		time.Sleep(10 * time.Millisecond)
+		require.Equal(t, 1, s.count())
+		close(s.gate)
+		require.Equal(t, v1, <-results)
+		require.Equal(t, v1, <-results)
+		require.Equal(t, 2, s.count())
+		_, err := c.GetRules()
+		require.Nil(t, err)
+		require.Equal(t, 2, s.count())
+	})
+	t.Run("should release waiting callers if the subject panics", func(t *testing.T) {
+		s := &loadingSubject{rules: v1, gate: make(chan struct{}), called: make(chan struct{}, 10), panics: true}
+		c := NewCachedSubject(s, clock)
+		recovered := make(chan interface{})
+		go func() {
+			defer func() { recovered <- recover() }()
+			c.GetRules()
+		}()
+		<-s.called
+		waited := make(chan error)
+		go func() {
+			_, err := c.GetRules()
+			waited <- err
+		}()
+		time.Sleep(10 * time.Millisecond)
+		close(s.gate)
+		require.Equal(t, "boom", <-recovered)
+		require.Equal(t, errLoadPanicked, <-waited)
+
+		s.mu.Lock()
+		s.panics = false
+		s.mu.Unlock()
+		rules, err := c.GetRules()
+		require.Nil(t, err)
+		require.Equal(t, v1, rules)
+	})
+	t.Run("should keep stale rules if the subject panics in the background", func(t *testing.T) {
+		s := &loadingSubject{rules: v1}
+		c := NewCachedSubject(s, clock, RulesTTL(time.Minute), StaleTTL(time.Minute), ErrorTTL(20*time.Second))
+		_, err := c.GetRules()
+		require.Nil(t, err)
+
+		s.mu.Lock()
+		s.panics = true
+		s.mu.Unlock()
+		advance(70 * time.Second)
+		rules, err := c.GetRules()
+		require.Nil(t, err)
+		require.Equal(t, v1, rules)
+		waitFor(c, s, 2)
+		for i := 0; i < 3; i++ {
+			rules, err := c.GetRules()
+			require.Nil(t, err)
+			require.Equal(t, v1, rules)
+		}
+		require.Equal(t, 2, s.count(), "the panic should be remembered for the error TTL")
+		c.mu.Lock()
+		require.Equal(t, errLoadPanicked, c.err)
+		c.mu.Unlock()
+
+		advance(time.Minute)
+		require.PanicsWithValue(t, "boom", func() { c.GetRules() }, "the subject should be called by the caller once the stale TTL is over")
+	})
+	t.Run("should have the key of the subject", func(t *testing.T) {
+		require.Equal(t, "user:1", NewCachedSubject(keyedLoadingSubject{loadingSubject: &loadingSubject{}, key: "user:1"}).SubjectKey())
+		require.Equal(t, "", NewCachedSubject(&loadingSubject{}).SubjectKey())
+	})
+	t.Run("should work with Can", func(t *testing.T) {
+		c := NewCachedSubject(&loadingSubject{rules: v1}, clock)
+		ok, err := authr.Can(c, "read", MapResource("zone", nil))
+		require.Nil(t, err)
+		require.True(t, ok)
+	})
+	t.Run("should work with intersections", func(t *testing.T) {
+		member := &loadingSubject{rules: v1}
+		c := NewCachedSubject(authr.Bounded(member, authr.RuleList(v2)), clock)
+		for i := 0; i < 2; i++ {
+			d, err := authr.Decide(c, "read", MapResource("zone", nil))
+			require.Nil(t, err)
+			require.False(t, d.Allowed)
+			require.Equal(t, "boundary", d.Layer)
+		}
+		require.Equal(t, 1, member.count())
+	})
+	t.Run("should panic on invalid options", func(t *testing.T) {
+		require.Panics(t, func() { NewCachedSubject(nil) })
+		require.Panics(t, func() { NewCachedSubject(&loadingSubject{}, RulesTTL(0)) })
+		require.Panics(t, func() { NewCachedSubject(&loadingSubject{}, StaleTTL(-1)) })
+		require.Panics(t, func() { NewCachedSubject(&loadingSubject{}, CacheClock(nil)) })
+	})
+}
@@ -0,0 +1,156 @@
+package authrutil
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cloudflare/authr/v3"
+)
+
+type namedResource struct {
+	authr.Resource
+	name string
+}
+
+type prefixedResource struct {
+	authr.Resource
+	prefix string
+}
+
+// Named gives a source passed to Compose a name to report when it provides
+// an attribute. Unnamed sources are reported by their position.
+func Named(name string, r authr.Resource) authr.Resource {
+	return namedResource{Resource: r, name: name}
+}
+
+// Prefixed namespaces the attributes of a source passed to Compose, so that
+// a rule referencing "@parent.owner_id" is delegated to the source as
+// "owner_id" when given a prefix of "parent". A prefixed source will only be
+// consulted for attributes in its namespace, and is reported by its prefix
+// unless it is also Named.
+func Prefixed(prefix string, r authr.Resource) authr.Resource {
+	return prefixedResource{Resource: r, prefix: prefix}
+}
+
+// Composite is a resource that resolves attributes from an ordered list of
+// sources. It is safe for concurrent use.
+type Composite struct {
+	typ     string
+	sources []source
+
+	mu         sync.Mutex
+	provenance map[string]string
+}
+
+type source struct {
+	name, prefix string
+	r            authr.Resource
+}
+
+var _ authr.Resource = &Composite{}
+
+// Compose accepts a string that indicates the "rsrc_type" of a resource, and
+// the sources of its attributes, in order of precedence. An attribute is
+// resolved from the first source that returns a non-nil value for it, where a
+// nil pointer, slice, map, etc. like a NULL column of a struct also counts as
+// nil; a source
+// returning an error stops the lookup and the error is returned. This function
+// will panic if any of the sources are nil.
+//
+//	authrutil.Compose("dns_record",
+//	    authrutil.Named("db", authrutil.StructResource("dns_record", row)),
+//	    authrutil.Named("computed", authrutil.MapResource("dns_record", computed)),
+//	    authrutil.Prefixed("zone", authrutil.StructResource("zone", zone)),
+//	)
+func Compose(typ string, sources ...authr.Resource) *Composite {
+	c := &Composite{
+		typ:        typ,
+		sources:    make([]source, len(sources)),
+		provenance: make(map[string]string),
+	}
+	for i, r := range sources {
+		var s source
+		for s.r == nil {
+			if r == nil {
+				panic("authrutil.Compose provided with a nil source")
+			}
+			switch w := r.(type) {
+			case namedResource:
+				s.name, r = w.name, w.Resource
+			case prefixedResource:
+				s.prefix, r = w.prefix+".", w.Resource
+				if s.name == "" {
+					s.name = w.prefix
+				}
+			default:
+				s.r = r
+			}
+		}
+		if s.name == "" {
+			s.name = strconv.Itoa(i)
+		}
+		c.sources[i] = s
+	}
+	return c
+}
+
+func (c *Composite) GetResourceType() (string, error) {
+	return c.typ, nil
+}
+
+func (c *Composite) GetResourceAttribute(key string) (interface{}, error) {
+	v, _, err := c.Lookup(key)
+	return v, err
+}
+
+// Lookup resolves an attribute just like GetResourceAttribute, but also returns
+// the name of the source that provided it. The name is empty if no source did.
+func (c *Composite) Lookup(key string) (interface{}, string, error) {
+	for _, s := range c.sources {
+		k := key
+		if s.prefix != "" {
+			if !strings.HasPrefix(key, s.prefix) {
+				continue
+			}
+			k = key[len(s.prefix):]
+		}
+		v, err := s.r.GetResourceAttribute(k)
+		if err != nil {
+			return nil, s.name, err
+		}
+		if !isNil(v) {
+			c.mu.Lock()
+			c.provenance[key] = s.name
+			c.mu.Unlock()
+			return v, s.name, nil
+		}
+	}
+	return nil, "", nil
+}
+
+// isNil reports whether v is nil, or a nil value of a type that can be nil.
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface, reflect.Func, reflect.Chan:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// Provenance reports the name of the source that provided each attribute that
+// has been resolved so far, which is useful when explaining a decision.
+func (c *Composite) Provenance() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p := make(map[string]string, len(c.provenance))
+	for k, v := range c.provenance {
+		p[k] = v
+	}
+	return p
+}
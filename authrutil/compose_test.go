@@ -0,0 +1,90 @@
+package authrutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cloudflare/authr/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompose(t *testing.T) {
+	row := MapResource("dns_record", map[string]interface{}{"id": "r1", "name": "www", "ttl": nil})
+	computed := MapResource("dns_record", map[string]interface{}{"ttl": 300, "name": "ignored"})
+	zone := StructResource("zone", struct {
+		ID      string `authr:"id"`
+		OwnerID string `authr:"owner_id"`
+	}{ID: "z1", OwnerID: "u1"})
+
+	t.Run("should return the provided resource type", func(t *testing.T) {
+		rt, err := Compose("dns_record", row).GetResourceType()
+		require.Nil(t, err)
+		require.Equal(t, "dns_record", rt)
+	})
+	t.Run("should resolve from the first source with a value", func(t *testing.T) {
+		c := Compose("dns_record", Named("db", row), Named("computed", computed))
+		for k, want := range map[string]interface{}{"id": "r1", "name": "www", "ttl": 300, "nope": nil} {
+			av, err := c.GetResourceAttribute(k)
+			require.Nil(t, err)
+			require.Equal(t, want, av, "attribute %q", k)
+		}
+	})
+	t.Run("should skip typed nils from struct sources", func(t *testing.T) {
+		db := StructResource("dns_record", struct {
+			Name *string  `authr:"name"`
+			Tags []string `authr:"tags"`
+		}{})
+		c := Compose("dns_record", Named("db", db), Named("computed", MapResource("dns_record", map[string]interface{}{"name": "www", "tags": []string{"a"}})))
+		for k, want := range map[string]interface{}{"name": "www", "tags": []string{"a"}} {
+			v, source, err := c.Lookup(k)
+			require.Nil(t, err)
+			require.Equal(t, want, v, "attribute %q", k)
+			require.Equal(t, "computed", source)
+		}
+	})
+	t.Run("should delegate prefixed attributes", func(t *testing.T) {
+		c := Compose("dns_record", row, Prefixed("zone", zone))
+		av, err := c.GetResourceAttribute("zone.owner_id")
+		require.Nil(t, err)
+		require.Equal(t, "u1", av)
+		av, err = c.GetResourceAttribute("zone.id")
+		require.Nil(t, err)
+		require.Equal(t, "z1", av)
+		av, err = c.GetResourceAttribute("owner_id")
+		require.Nil(t, err)
+		require.Nil(t, av, "prefixed sources should only be consulted within their namespace")
+	})
+	t.Run("should report which source provided each value", func(t *testing.T) {
+		c := Compose("dns_record", Named("db", row), computed, Prefixed("zone", zone), Named("parent", Prefixed("p", zone)))
+		for k, want := range map[string]string{"id": "db", "ttl": "1", "zone.owner_id": "zone", "p.id": "parent", "nope": ""} {
+			_, src, err := c.Lookup(k)
+			require.Nil(t, err)
+			require.Equal(t, want, src, "attribute %q", k)
+		}
+		require.Equal(t, map[string]string{"id": "db", "ttl": "1", "zone.owner_id": "zone", "p.id": "parent"}, c.Provenance())
+	})
+	t.Run("should stop and return errors from sources", func(t *testing.T) {
+		failing := FuncResource("dns_record", map[string]AttributeLoader{
+			"ttl": func() (interface{}, error) { return nil, errors.New("boom") },
+		})
+		_, src, err := Compose("dns_record", Named("lazy", failing), computed).Lookup("ttl")
+		require.EqualError(t, err, "boom")
+		require.Equal(t, "lazy", src)
+	})
+	t.Run("should panic if given a nil source", func(t *testing.T) {
+		require.Panics(t, func() {
+			Compose("dns_record", row, nil)
+		})
+	})
+	t.Run("should be usable with rules", func(t *testing.T) {
+		ok, err := authr.Can(ruleSubject{
+			new(authr.Rule).Access(authr.Allow).Where(
+				authr.Action("update"),
+				authr.ResourceType("dns_record"),
+				authr.ResourceMatch(authr.Cond("@zone.owner_id", "=", "u1")),
+			),
+		}, "update", Compose("dns_record", row, Prefixed("zone", zone)))
+		require.Nil(t, err)
+		require.True(t, ok)
+	})
+}
@@ -0,0 +1,68 @@
+package authrutil
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/cloudflare/authr/v3"
+)
+
+// AttributeLoader retrieves the value of a single resource attribute.
+type AttributeLoader func() (interface{}, error)
+
+type loadedAttribute struct {
+	sync.Mutex
+	load   AttributeLoader
+	loaded bool
+	v      interface{}
+}
+
+type funcResource struct {
+	typ   string
+	attrs map[string]*loadedAttribute
+}
+
+func (f *funcResource) GetResourceType() (string, error) {
+	return f.typ, nil
+}
+
+func (f *funcResource) GetResourceAttribute(key string) (interface{}, error) {
+	a, ok := f.attrs[key]
+	if !ok {
+		return nil, nil
+	}
+	a.Lock()
+	defer a.Unlock()
+	if a.loaded {
+		return a.v, nil
+	}
+	v, err := a.load()
+	if err != nil {
+		return nil, err
+	}
+	a.v, a.loaded = v, true
+	return v, nil
+}
+
+var _ authr.Resource = &funcResource{}
+
+// FuncResource accepts a string that indicates the "rsrc_type" of a resource,
+// and a loader function for each of its attributes. A loader is only called
+// when a rule references its attribute, and a successfully loaded value is
+// remembered for the lifetime of the resource, so expensive attributes are
+// only paid for when needed and at most once. Errors are not remembered; the
+// loader will be called again on the next lookup. Attributes without a loader
+// will resolve to nil.
+//
+// The returned resource is safe for concurrent use. This function will panic
+// if any of the loaders is nil.
+func FuncResource(typ string, loaders map[string]AttributeLoader) authr.Resource {
+	attrs := make(map[string]*loadedAttribute, len(loaders))
+	for k, l := range loaders {
+		if l == nil {
+			panic(fmt.Sprintf("authrutil.FuncResource provided with a nil loader for attribute '%s'", k))
+		}
+		attrs[k] = &loadedAttribute{load: l}
+	}
+	return &funcResource{typ: typ, attrs: attrs}
+}
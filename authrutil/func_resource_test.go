@@ -0,0 +1,72 @@
+package authrutil
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFuncResource(t *testing.T) {
+	t.Run("should return the provided resource type", func(t *testing.T) {
+		rt, err := FuncResource("a", nil).GetResourceType()
+		require.Nil(t, err)
+		require.Equal(t, "a", rt)
+	})
+	t.Run("should load attributes lazily and only once", func(t *testing.T) {
+		var owner, members int32
+		fr := FuncResource("group", map[string]AttributeLoader{
+			"owner": func() (interface{}, error) {
+				atomic.AddInt32(&owner, 1)
+				return "jane", nil
+			},
+			"members": func() (interface{}, error) {
+				atomic.AddInt32(&members, 1)
+				return []string{"jane"}, nil
+			},
+		})
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				av, err := fr.GetResourceAttribute("owner")
+				require.Nil(t, err)
+				require.Equal(t, "jane", av)
+			}()
+		}
+		wg.Wait()
+		require.Equal(t, int32(1), atomic.LoadInt32(&owner))
+		require.Equal(t, int32(0), atomic.LoadInt32(&members))
+	})
+	t.Run("should not remember errors", func(t *testing.T) {
+		calls := 0
+		fr := FuncResource("group", map[string]AttributeLoader{
+			"owner": func() (interface{}, error) {
+				calls++
+				if calls == 1 {
+					return nil, errors.New("db down")
+				}
+				return "jane", nil
+			},
+		})
+		_, err := fr.GetResourceAttribute("owner")
+		require.EqualError(t, err, "db down")
+		av, err := fr.GetResourceAttribute("owner")
+		require.Nil(t, err)
+		require.Equal(t, "jane", av)
+		require.Equal(t, 2, calls)
+	})
+	t.Run("should return <nil> for attributes without a loader", func(t *testing.T) {
+		av, err := FuncResource("group", nil).GetResourceAttribute("nope")
+		require.Nil(t, err)
+		require.Nil(t, av)
+	})
+	t.Run("should panic on a nil loader", func(t *testing.T) {
+		require.PanicsWithValue(t, "authrutil.FuncResource provided with a nil loader for attribute 'owner'", func() {
+			FuncResource("group", map[string]AttributeLoader{"owner": nil})
+		})
+	})
+}
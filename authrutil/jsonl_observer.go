@@ -0,0 +1,238 @@
+package authrutil
+
+import (
+	"encoding/json"
+	"io"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudflare/authr/v3"
+)
+
+// Redacted replaces the values of redacted attributes in the records of a
+// JSONLinesObserver.
+const Redacted = "[REDACTED]"
+
+// JSONLinesOption configures a JSONLinesObserver.
+type JSONLinesOption func(*JSONLinesObserver)
+
+// SampleRate sets the fraction of events that are recorded, between 0 and 1.
+// The default is 1, every event is recorded.
+func SampleRate(rate float64) JSONLinesOption {
+	return func(o *JSONLinesObserver) {
+		o.rate = rate
+	}
+}
+
+// Redact replaces the values of the provided attributes with Redacted in the
+// records.
+func Redact(attributes ...string) JSONLinesOption {
+	return func(o *JSONLinesObserver) {
+		for _, a := range attributes {
+			o.redact[a] = true
+		}
+	}
+}
+
+// BufferSize sets how many events can wait to be written before further events
+// are dropped, which must be at least 1. The default is 1024.
+func BufferSize(size int) JSONLinesOption {
+	return func(o *JSONLinesObserver) {
+		o.size = size
+	}
+}
+
+// OnWriteError sets the function called with errors writing records. By
+// default, they are ignored.
+func OnWriteError(f func(error)) JSONLinesOption {
+	return func(o *JSONLinesObserver) {
+		o.onError = f
+	}
+}
+
+// JSONLinesObserver is an authr.DecisionObserver that writes a JSON object per
+// line for every recorded event, like:
+//
+//	{"time":"2020-01-01T00:00:00Z","subject":"user:1","action":"delete","resource_type":"zone","attributes":{"id":"z1"},"allowed":false,"rule_index":0,"rule_id":"no-locked-deletes","layer":"guardrails","latency_ms":0.012}
+//
+// "error" and "fallback" are added for attempts that failed or were decided
+// despite an error, and "cached" for decisions from an authr.DecisionCache.
+//
+// Events are written by a single goroutine, so that observing them never
+// blocks an attempt: if the buffer is full because the writer cannot keep up,
+// the event is dropped and counted instead, see Dropped. Their attributes are
+// encoded right away though, since they may be modified once the attempt is
+// over. Close must be called to flush the buffered events.
+type JSONLinesObserver struct {
+	// accessed atomically, first for 64-bit alignment on 32-bit platforms
+	dropped int64
+
+	enc     *json.Encoder
+	rate    float64
+	random  func() float64
+	redact  map[string]bool
+	size    int
+	onError func(error)
+
+	mu     sync.RWMutex
+	closed bool
+	events chan queuedRecord
+	done   chan struct{}
+	// err is the first error writing a record, only read once done is closed
+	err error
+}
+
+var (
+	_ authr.DecisionObserver = &JSONLinesObserver{}
+	_ authr.DecisionSampler  = &JSONLinesObserver{}
+)
+
+// NewJSONLinesObserver returns a JSONLinesObserver writing to w, which must be
+// safe to use from another goroutine. This function will panic if w is nil,
+// the sample rate is not between 0 and 1 or the buffer size is less than 1.
+func NewJSONLinesObserver(w io.Writer, opts ...JSONLinesOption) *JSONLinesObserver {
+	if w == nil {
+		panic("authrutil.NewJSONLinesObserver provided with a nil writer")
+	}
+	o := &JSONLinesObserver{
+		enc:    json.NewEncoder(w),
+		rate:   1,
+		random: rand.Float64,
+		redact: make(map[string]bool),
+		size:   1024,
+		done:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.rate < 0 || o.rate > 1 {
+		panic("authrutil.NewJSONLinesObserver provided with a sample rate outside of [0, 1]")
+	}
+	if o.size < 1 {
+		panic("authrutil.NewJSONLinesObserver provided with a buffer size less than 1")
+	}
+	o.events = make(chan queuedRecord, o.size)
+	go o.write()
+	return o
+}
+
+// SampleDecision implements authr.DecisionSampler, sampling events at the
+// sample rate.
+func (o *JSONLinesObserver) SampleDecision(authr.DecisionEvent) bool {
+	return o.rate >= 1 || o.random() < o.rate
+}
+
+// ObserveDecision records the event, unless it is dropped because the buffer
+// is full or the observer is closed. Events are not sampled here, but by an
+// Authorizer calling SampleDecision first.
+func (o *JSONLinesObserver) ObserveDecision(e authr.DecisionEvent) {
+	r, err := o.record(e)
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if o.closed {
+		atomic.AddInt64(&o.dropped, 1)
+		return
+	}
+	select {
+	case o.events <- queuedRecord{r: r, err: err}:
+	default:
+		atomic.AddInt64(&o.dropped, 1)
+	}
+}
+
+// Dropped returns the number of sampled events that were not recorded.
+func (o *JSONLinesObserver) Dropped() int64 {
+	return atomic.LoadInt64(&o.dropped)
+}
+
+// Close writes the buffered events and stops the observer, returning the first
+// error writing a record, if any. Events observed afterwards are dropped.
+func (o *JSONLinesObserver) Close() error {
+	o.mu.Lock()
+	if !o.closed {
+		o.closed = true
+		close(o.events)
+	}
+	o.mu.Unlock()
+	<-o.done
+	return o.err
+}
+
+type jsonRecord struct {
+	Time         time.Time       `json:"time"`
+	Subject      string          `json:"subject,omitempty"`
+	Action       string          `json:"action"`
+	ResourceType string          `json:"resource_type,omitempty"`
+	Attributes   json.RawMessage `json:"attributes,omitempty"`
+	Allowed      bool            `json:"allowed"`
+	RuleIndex    int             `json:"rule_index"`
+	RuleID       string          `json:"rule_id,omitempty"`
+	Layer        string          `json:"layer,omitempty"`
+	Fallback     string          `json:"fallback,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	Cached       bool            `json:"cached,omitempty"`
+	LatencyMS    float64         `json:"latency_ms"`
+}
+
+func (o *JSONLinesObserver) write() {
+	defer close(o.done)
+	for q := range o.events {
+		err := q.err
+		if err == nil {
+			err = o.enc.Encode(q.r)
+		}
+		if err == nil {
+			continue
+		}
+		if o.err == nil {
+			o.err = err
+		}
+		if o.onError != nil {
+			o.onError(err)
+		}
+	}
+}
+
+// queuedRecord is a record waiting to be written, or the error encoding its
+// attributes.
+type queuedRecord struct {
+	r   jsonRecord
+	err error
+}
+
+func (o *JSONLinesObserver) record(e authr.DecisionEvent) (jsonRecord, error) {
+	r := jsonRecord{
+		Time:         e.Time,
+		Subject:      e.SubjectKey,
+		Action:       e.Action,
+		ResourceType: e.ResourceType,
+		Allowed:      e.Decision.Allowed && e.Err == nil,
+		RuleIndex:    e.Decision.RuleIndex,
+		RuleID:       e.Decision.RuleID,
+		Layer:        e.Decision.Layer,
+		Cached:       e.Cached,
+		LatencyMS:    float64(e.Latency) / float64(time.Millisecond),
+	}
+	if len(e.Attributes) > 0 {
+		attributes := make(map[string]interface{}, len(e.Attributes))
+		for k, v := range e.Attributes {
+			if o.redact[k] {
+				v = Redacted
+			}
+			attributes[k] = v
+		}
+		var err error
+		if r.Attributes, err = json.Marshal(attributes); err != nil {
+			return r, err
+		}
+	}
+	if e.Decision.Fallback != authr.NoFallback {
+		r.Fallback = e.Decision.Fallback.String()
+	}
+	if e.Err != nil {
+		r.Error = e.Err.Error()
+	}
+	return r, nil
+}
@@ -0,0 +1,244 @@
+package authrutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/authr/v3"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingWriter blocks every write until it is released.
+type blockingWriter struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func lines(t *testing.T, s string) []map[string]interface{} {
+	var records []map[string]interface{}
+	for _, l := range strings.Split(strings.TrimSpace(s), "\n") {
+		if l == "" {
+			continue
+		}
+		var r map[string]interface{}
+		require.Nil(t, json.Unmarshal([]byte(l), &r))
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestJSONLinesObserver(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	deny := new(authr.Rule).ID("no-locked-deletes").Access(authr.Deny).Where(authr.Action("delete"), authr.ResourceType("zone"), authr.ResourceMatch())
+	event := authr.DecisionEvent{
+		Time:         now,
+		SubjectKey:   "user:1",
+		Action:       "delete",
+		ResourceType: "zone",
+		Attributes:   map[string]interface{}{"id": "z1", "owner_email": "someone@example.com"},
+		Decision:     authr.Decision{Rule: deny, RuleIndex: 0, RuleID: "no-locked-deletes", Layer: "guardrails"},
+		Latency:      1500 * time.Microsecond,
+	}
+
+	t.Run("should write a record per line", func(t *testing.T) {
+		var buf bytes.Buffer
+		o := NewJSONLinesObserver(&buf)
+		o.ObserveDecision(event)
+		failed := event
+		failed.Attributes = nil
+		failed.Decision = authr.Decision{Allowed: true, RuleIndex: -1, Fallback: authr.FailedOpen, Cause: errors.New("db down")}
+		failed.Cached = true
+		o.ObserveDecision(failed)
+		failed.Decision.Allowed, failed.Decision.Fallback = true, authr.NoFallback
+		failed.Err = errors.New("mfa required")
+		o.ObserveDecision(failed)
+		require.Nil(t, o.Close())
+		require.Equal(t, []map[string]interface{}{
+			{
+				"time":          "2020-01-01T00:00:00Z",
+				"subject":       "user:1",
+				"action":        "delete",
+				"resource_type": "zone",
+				"attributes":    map[string]interface{}{"id": "z1", "owner_email": "someone@example.com"},
+				"allowed":       false,
+				"rule_index":    float64(0),
+				"rule_id":       "no-locked-deletes",
+				"layer":         "guardrails",
+				"latency_ms":    1.5,
+			},
+			{
+				"time":          "2020-01-01T00:00:00Z",
+				"subject":       "user:1",
+				"action":        "delete",
+				"resource_type": "zone",
+				"allowed":       true,
+				"rule_index":    float64(-1),
+				"fallback":      "failed open",
+				"cached":        true,
+				"latency_ms":    1.5,
+			},
+			{
+				"time":          "2020-01-01T00:00:00Z",
+				"subject":       "user:1",
+				"action":        "delete",
+				"resource_type": "zone",
+				"allowed":       false,
+				"rule_index":    float64(-1),
+				"error":         "mfa required",
+				"cached":        true,
+				"latency_ms":    1.5,
+			},
+		}, lines(t, buf.String()))
+	})
+	t.Run("should redact attributes", func(t *testing.T) {
+		var buf bytes.Buffer
+		o := NewJSONLinesObserver(&buf, Redact("owner_email"))
+		o.ObserveDecision(event)
+		require.Nil(t, o.Close())
+		require.Equal(t, map[string]interface{}{"id": "z1", "owner_email": Redacted}, lines(t, buf.String())[0]["attributes"])
+		require.Equal(t, "someone@example.com", event.Attributes["owner_email"], "the event should not be modified")
+	})
+	t.Run("should sample events", func(t *testing.T) {
+		o := NewJSONLinesObserver(&bytes.Buffer{}, SampleRate(0.25))
+		n := 0
+		o.random = func() float64 {
+			n++
+			return float64(n%4) / 4
+		}
+		sampled := 0
+		for i := 0; i < 8; i++ {
+			if o.SampleDecision(event) {
+				sampled++
+			}
+		}
+		require.Equal(t, 2, sampled)
+		require.Nil(t, o.Close())
+
+		o = NewJSONLinesObserver(&bytes.Buffer{}, SampleRate(0))
+		require.False(t, o.SampleDecision(event))
+		require.Nil(t, o.Close())
+		o = NewJSONLinesObserver(&bytes.Buffer{})
+		require.True(t, o.SampleDecision(event))
+		require.Nil(t, o.Close())
+	})
+	t.Run("should not retrieve attributes of events that are not sampled", func(t *testing.T) {
+		var buf bytes.Buffer
+		o := NewJSONLinesObserver(&buf, SampleRate(0.5))
+		n := 0
+		o.random = func() float64 {
+			n++
+			return float64(n%2) / 2
+		}
+		loads := 0
+		a := authr.NewAuthorizer(authr.WithDecisionObserver(o, "id"))
+		for i := 0; i < 2; i++ {
+			zone := FuncResource("zone", map[string]AttributeLoader{"id": func() (interface{}, error) {
+				loads++
+				return "z1", nil
+			}})
+			_, err := a.Can(authr.RuleList{deny}, "delete", zone)
+			require.Nil(t, err)
+		}
+		require.Nil(t, o.Close())
+		require.Len(t, lines(t, buf.String()), 1)
+		require.Equal(t, 1, loads)
+	})
+	t.Run("should drop and count events without blocking", func(t *testing.T) {
+		w := &blockingWriter{release: make(chan struct{})}
+		o := NewJSONLinesObserver(w, BufferSize(2))
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 10; i++ {
+				o.ObserveDecision(event)
+			}
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("ObserveDecision blocked")
+		}
+		// the writer holds at most one event, and the buffer two more
+		require.True(t, o.Dropped() >= 7, "dropped %d", o.Dropped())
+		close(w.release)
+		require.Nil(t, o.Close())
+		require.Equal(t, int64(10), o.Dropped()+int64(len(lines(t, w.buf.String()))))
+
+		o.ObserveDecision(event)
+		require.Equal(t, int64(11), o.Dropped()+int64(len(lines(t, w.buf.String()))), "events after Close should be dropped")
+		require.Nil(t, o.Close())
+	})
+	t.Run("should report write errors", func(t *testing.T) {
+		var errs []error
+		o := NewJSONLinesObserver(failingWriter{}, OnWriteError(func(err error) {
+			errs = append(errs, err)
+		}))
+		o.ObserveDecision(event)
+		o.ObserveDecision(event)
+		require.EqualError(t, o.Close(), "disk full")
+		require.Len(t, errs, 2)
+	})
+	t.Run("should record decisions of an Authorizer", func(t *testing.T) {
+		var buf bytes.Buffer
+		o := NewJSONLinesObserver(&buf)
+		a := authr.NewAuthorizer(authr.WithDecisionObserver(o, "id"))
+		ok, err := a.Can(authr.RuleList{deny}, "delete", MapResource("zone", map[string]interface{}{"id": "z1"}))
+		require.Nil(t, err)
+		require.False(t, ok)
+		require.Nil(t, o.Close())
+		records := lines(t, buf.String())
+		require.Len(t, records, 1)
+		require.Equal(t, "no-locked-deletes", records[0]["rule_id"])
+		require.Equal(t, map[string]interface{}{"id": "z1"}, records[0]["attributes"])
+	})
+	t.Run("should not retain attributes", func(t *testing.T) {
+		w := &blockingWriter{release: make(chan struct{})}
+		o := NewJSONLinesObserver(w)
+		a := authr.NewAuthorizer(authr.WithDecisionObserver(o, "tags"))
+		tags := map[string]interface{}{"env": "prod"}
+		_, err := a.Can(authr.RuleList{deny}, "delete", MapResource("zone", map[string]interface{}{"tags": tags}))
+		require.Nil(t, err)
+		tags["env"] = "staging"
+		tags["team"] = "dns"
+		close(w.release)
+		require.Nil(t, o.Close())
+		records := lines(t, w.buf.String())
+		require.Len(t, records, 1)
+		require.Equal(t, map[string]interface{}{"tags": map[string]interface{}{"env": "prod"}}, records[0]["attributes"])
+	})
+	t.Run("should report attributes that cannot be encoded", func(t *testing.T) {
+		var buf bytes.Buffer
+		o := NewJSONLinesObserver(&buf)
+		unencodable := event
+		unencodable.Attributes = map[string]interface{}{"f": func() {}}
+		o.ObserveDecision(unencodable)
+		o.ObserveDecision(event)
+		require.NotNil(t, o.Close())
+		require.Len(t, lines(t, buf.String()), 1)
+	})
+	t.Run("should panic on invalid options", func(t *testing.T) {
+		require.Panics(t, func() { NewJSONLinesObserver(nil) })
+		require.Panics(t, func() { NewJSONLinesObserver(&bytes.Buffer{}, SampleRate(1.5)) })
+		require.Panics(t, func() { NewJSONLinesObserver(&bytes.Buffer{}, BufferSize(-1)) })
+		require.Panics(t, func() { NewJSONLinesObserver(&bytes.Buffer{}, BufferSize(0)) })
+	})
+}
@@ -0,0 +1,47 @@
+package authrutil
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/cloudflare/authr/v3"
+)
+
+type mapResource struct {
+	typ string
+	m   map[string]interface{}
+}
+
+func (m mapResource) GetResourceType() (string, error) {
+	return m.typ, nil
+}
+
+func (m mapResource) GetResourceAttribute(key string) (interface{}, error) {
+	return m.m[key], nil
+}
+
+var _ authr.Resource = mapResource{}
+
+// MapResource accepts a string that indicates the "rsrc_type" of a resource,
+// and a map whose entries are the attributes of the resource. Keys that are not
+// present in the map will resolve to nil.
+func MapResource(typ string, m map[string]interface{}) authr.Resource {
+	return mapResource{typ: typ, m: m}
+}
+
+// JSONResource accepts a string that indicates the "rsrc_type" of a resource,
+// and a JSON object whose properties are the attributes of the resource. The
+// JSON is decoded once, up front, and an error is returned if it is not an
+// object. Values have the same types as when decoded by encoding/json into an
+// interface{}, so numbers are float64, arrays are []interface{} and so on.
+func JSONResource(typ string, data []byte) (authr.Resource, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("authrutil.JSONResource expects a JSON object, got %T", v)
+	}
+	return mapResource{typ: typ, m: m}, nil
+}
@@ -0,0 +1,81 @@
+package authrutil
+
+import (
+	"testing"
+
+	"github.com/cloudflare/authr/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapResource(t *testing.T) {
+	t.Run("should return the provided resource type", func(t *testing.T) {
+		rt, err := MapResource("a", nil).GetResourceType()
+		require.Nil(t, err)
+		require.Equal(t, "a", rt)
+	})
+	t.Run("should retrieve values from the map", func(t *testing.T) {
+		mr := MapResource("thing", map[string]interface{}{"foo": 5, "tags": []string{"a"}})
+		av, err := mr.GetResourceAttribute("foo")
+		require.Nil(t, err)
+		require.Equal(t, 5, av)
+		av, err = mr.GetResourceAttribute("tags")
+		require.Nil(t, err)
+		require.Equal(t, []string{"a"}, av)
+	})
+	t.Run("should return <nil> for missing keys", func(t *testing.T) {
+		av, err := MapResource("thing", map[string]interface{}{}).GetResourceAttribute("nope")
+		require.Nil(t, err)
+		require.Nil(t, av)
+	})
+}
+
+func TestJSONResource(t *testing.T) {
+	t.Run("should retrieve decoded values from the object", func(t *testing.T) {
+		jr, err := JSONResource("zone", []byte(`{"id":"123","plan":{"name":"pro"},"ns":["a","b"],"ttl":300}`))
+		require.Nil(t, err)
+		rt, err := jr.GetResourceType()
+		require.Nil(t, err)
+		require.Equal(t, "zone", rt)
+		for k, want := range map[string]interface{}{
+			"id":   "123",
+			"plan": map[string]interface{}{"name": "pro"},
+			"ns":   []interface{}{"a", "b"},
+			"ttl":  float64(300),
+			"nope": nil,
+		} {
+			av, err := jr.GetResourceAttribute(k)
+			require.Nil(t, err)
+			require.Equal(t, want, av, "attribute %q", k)
+		}
+	})
+	t.Run("should err on invalid JSON", func(t *testing.T) {
+		_, err := JSONResource("zone", []byte(`{"id":`))
+		require.NotNil(t, err)
+	})
+	t.Run("should err on non-object JSON", func(t *testing.T) {
+		_, err := JSONResource("zone", []byte(`[1,2]`))
+		require.EqualError(t, err, "authrutil.JSONResource expects a JSON object, got []interface {}")
+	})
+	t.Run("should be usable with rules", func(t *testing.T) {
+		jr, err := JSONResource("zone", []byte(`{"ns":["a","b"],"ttl":300}`))
+		require.Nil(t, err)
+		ok, err := authr.Can(ruleSubject{
+			new(authr.Rule).Access(authr.Allow).Where(
+				authr.Action("edit"),
+				authr.ResourceType("zone"),
+				authr.ResourceMatch(
+					authr.Cond("@ttl", "=", 300),
+					authr.Cond("b", "$in", "@ns"),
+				),
+			),
+		}, "edit", jr)
+		require.Nil(t, err)
+		require.True(t, ok)
+	})
+}
+
+type ruleSubject []*authr.Rule
+
+func (r ruleSubject) GetRules() ([]*authr.Rule, error) {
+	return r, nil
+}
@@ -1,15 +1,18 @@
 package authrutil
 
 import (
-	"go/ast"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/cloudflare/authr/v3"
 )
 
 type structResource struct {
-	typ string
-	v   reflect.Value
+	typ    string
+	v      reflect.Value
+	fields *structFields
 }
 
 func (s structResource) GetResourceType() (string, error) {
@@ -17,24 +20,176 @@ func (s structResource) GetResourceType() (string, error) {
 }
 
 func (s structResource) GetResourceAttribute(key string) (interface{}, error) {
-	if !ast.IsExported(key) {
-		return nil, nil
-	}
-	f, ok := s.v.Type().FieldByName(key)
+	idx, ok := s.fields.byTag[key]
 	if !ok {
-		return nil, nil
+		if idx, ok = s.fields.byName[key]; !ok {
+			return nil, nil
+		}
+	}
+	v := s.v
+	for _, i := range idx {
+		if v.Kind() == reflect.Ptr {
+			// nil embedded pointers hold no values
+			if v.IsNil() {
+				return nil, nil
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
 	}
-	return s.v.FieldByIndex(f.Index).Interface(), nil
+	return v.Interface(), nil
 }
 
 var _ authr.Resource = structResource{}
 
 // StructResource accepts a string that indicates the "rsrc_type" of a resource,
-// and the struct that needs to be acceptable as an authr.Resource. This
-// function will panic if v is NOT a struct.
+// and the struct (or pointer to one) that needs to be acceptable as an
+// authr.Resource. This function will panic if v is NOT a struct or a non-nil
+// pointer to a struct.
+//
+// Attributes are resolved by the name in an "authr" struct tag, falling back to
+// the name in a "json" tag. A field also keeps resolving by its own name, so
+// tagging a field does not break rules that reference it that way. Fields of
+// embedded structs are promoted the same way encoding/json promotes them. A
+// field can be hidden from rules entirely with a tag of `authr:"-"`:
+//
+//	type Post struct {
+//	    ID      int    `authr:"id"`
+//	    OwnerID string `json:"owner_id"`
+//	    Secret  string `authr:"-"`
+//	}
 func StructResource(typ string, v interface{}) authr.Resource {
-	if reflect.TypeOf(v).Kind() != reflect.Struct {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
 		panic("authrutil.StructResource provided with a non-struct value")
 	}
-	return structResource{typ: typ, v: reflect.ValueOf(v)}
+	return structResource{typ: typ, v: rv, fields: cachedFields(rv.Type())}
+}
+
+// structFields maps the attribute names of a struct type to the index sequence
+// of the field holding each: byTag by the names given in struct tags, and
+// byName by the names of the fields themselves.
+type structFields struct {
+	byTag, byName map[string][]int
+}
+
+var fieldCache sync.Map // map[reflect.Type]*structFields
+
+// cachedFields returns the attributes of a struct type, computing them only
+// once per type.
+func cachedFields(t reflect.Type) *structFields {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.(*structFields)
+	}
+	f, _ := fieldCache.LoadOrStore(t, &structFields{byTag: typeFields(t, true), byName: typeFields(t, false)})
+	return f.(*structFields)
+}
+
+type field struct {
+	name   string
+	index  []int
+	tagged bool
+}
+
+// typeFields finds the attributes of a struct type, following the visibility
+// rules of encoding/json for embedded structs: a field at a shallower depth
+// wins, at equal depths a tagged field wins, and any other conflict hides the
+// attribute entirely. If useTags is false, the names given in struct tags are
+// ignored, but fields tagged `authr:"-"` are still hidden.
+func typeFields(t reflect.Type, useTags bool) map[string][]int {
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+	var (
+		fields  []field
+		next    = []embedded{{typ: t}}
+		visited = map[reflect.Type]bool{}
+	)
+	for len(next) > 0 {
+		current := next
+		next = nil
+		for _, e := range current {
+			if visited[e.typ] {
+				continue
+			}
+			visited[e.typ] = true
+			for i := 0; i < e.typ.NumField(); i++ {
+				sf := e.typ.Field(i)
+				ft := sf.Type
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				exported := sf.PkgPath == ""
+				if !exported && !(sf.Anonymous && ft.Kind() == reflect.Struct) {
+					continue
+				}
+				name, ok := tagName(sf)
+				if !ok {
+					continue
+				}
+				if !useTags {
+					name = ""
+				}
+				index := make([]int, len(e.index)+1)
+				copy(index, e.index)
+				index[len(e.index)] = i
+				if name == "" && sf.Anonymous && ft.Kind() == reflect.Struct {
+					next = append(next, embedded{typ: ft, index: index})
+					continue
+				}
+				if !exported {
+					continue
+				}
+				f := field{name: name, index: index, tagged: name != ""}
+				if !f.tagged {
+					f.name = sf.Name
+				}
+				fields = append(fields, f)
+			}
+		}
+	}
+
+	sort.SliceStable(fields, func(i, j int) bool {
+		if fields[i].name != fields[j].name {
+			return fields[i].name < fields[j].name
+		}
+		if len(fields[i].index) != len(fields[j].index) {
+			return len(fields[i].index) < len(fields[j].index)
+		}
+		return fields[i].tagged && !fields[j].tagged
+	})
+	attrs := make(map[string][]int, len(fields))
+	for i := 0; i < len(fields); {
+		j := i + 1
+		for j < len(fields) && fields[j].name == fields[i].name {
+			j++
+		}
+		if j-i == 1 || len(fields[i].index) < len(fields[i+1].index) || fields[i].tagged != fields[i+1].tagged {
+			attrs[fields[i].name] = fields[i].index
+		}
+		i = j
+	}
+	return attrs
+}
+
+// tagName returns the attribute name given to a field by its "authr" or "json"
+// struct tag, or false if the field is hidden with `authr:"-"`. A field hidden
+// from encoding/json with `json:"-"` has no tag name, but is not hidden.
+func tagName(sf reflect.StructField) (string, bool) {
+	if tag, ok := sf.Tag.Lookup("authr"); ok {
+		if tag == "-" {
+			return "", false
+		}
+		if name := strings.Split(tag, ",")[0]; name != "" {
+			return name, true
+		}
+	}
+	if tag, ok := sf.Tag.Lookup("json"); ok && tag != "-" {
+		return strings.Split(tag, ",")[0], true
+	}
+	return "", true
 }
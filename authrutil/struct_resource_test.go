@@ -46,4 +46,128 @@ func TestStructResource(t *testing.T) {
 		require.Nil(t, err)
 		require.Nil(t, avnil)
 	})
+	t.Run("should accept a pointer to a struct", func(t *testing.T) {
+		sr := StructResource("thing", &struct{ Foo int }{Foo: 3})
+		av, err := sr.GetResourceAttribute("Foo")
+		require.Nil(t, err)
+		require.Equal(t, 3, av)
+	})
+	t.Run("should panic if given a nil pointer", func(t *testing.T) {
+		var p *struct{ Foo int }
+		require.Panics(t, func() {
+			StructResource("thing", p)
+		})
+	})
+	t.Run("should resolve attributes by struct tags", func(t *testing.T) {
+		sr := StructResource("post", struct {
+			ID      int    `authr:"id" json:"post_id"`
+			OwnerID string `json:"owner_id,omitempty"`
+			Title   string `json:",omitempty"`
+		}{ID: 1, OwnerID: "u2", Title: "hi"})
+		for k, want := range map[string]interface{}{"id": 1, "owner_id": "u2", "Title": "hi"} {
+			av, err := sr.GetResourceAttribute(k)
+			require.Nil(t, err)
+			require.Equal(t, want, av, "attribute %q", k)
+		}
+		av, err := sr.GetResourceAttribute("post_id")
+		require.Nil(t, err)
+		require.Nil(t, av, "json tags should not be used when there is an authr tag")
+	})
+	t.Run("should still resolve tagged fields by their name", func(t *testing.T) {
+		sr := StructResource("post", struct {
+			ID      int    `authr:"id"`
+			OwnerID string `json:"owner_id"`
+			Token   string `json:"-"`
+		}{ID: 1, OwnerID: "u2", Token: "t"})
+		for k, want := range map[string]interface{}{"ID": 1, "OwnerID": "u2", "Token": "t"} {
+			av, err := sr.GetResourceAttribute(k)
+			require.Nil(t, err)
+			require.Equal(t, want, av, "attribute %q", k)
+		}
+	})
+	t.Run("should prefer tag names over field names", func(t *testing.T) {
+		sr := StructResource("post", struct {
+			Owner   string
+			OwnerID string `authr:"Owner"`
+		}{Owner: "name", OwnerID: "u2"})
+		av, err := sr.GetResourceAttribute("Owner")
+		require.Nil(t, err)
+		require.Equal(t, "u2", av)
+	})
+	t.Run("should hide fields tagged with a dash", func(t *testing.T) {
+		sr := StructResource("user", struct {
+			Password string `authr:"-" json:"password"`
+		}{Password: "hunter2"})
+		for _, k := range []string{"Password", "password", "-"} {
+			av, err := sr.GetResourceAttribute(k)
+			require.Nil(t, err)
+			require.Nil(t, av)
+		}
+	})
+	t.Run("should promote fields of embedded structs", func(t *testing.T) {
+		type base struct {
+			ID    int `authr:"id"`
+			Owner string
+		}
+		type audit struct {
+			Created string `authr:"created"`
+		}
+		type Zone struct {
+			base
+			*audit
+			Name  string `authr:"name"`
+			Owner string `authr:"owner_name"`
+		}
+		sr := StructResource("zone", Zone{base: base{ID: 7, Owner: "base"}, Name: "a.com", Owner: "outer"})
+		for k, want := range map[string]interface{}{"id": 7, "Owner": "base", "name": "a.com", "owner_name": "outer"} {
+			av, err := sr.GetResourceAttribute(k)
+			require.Nil(t, err)
+			require.Equal(t, want, av, "attribute %q", k)
+		}
+		av, err := sr.GetResourceAttribute("created")
+		require.Nil(t, err)
+		require.Nil(t, av, "nil embedded pointers should hold no values")
+
+		sr = StructResource("zone", &Zone{audit: &audit{Created: "today"}})
+		av, err = sr.GetResourceAttribute("created")
+		require.Nil(t, err)
+		require.Equal(t, "today", av)
+	})
+	t.Run("should prefer shallower and tagged fields", func(t *testing.T) {
+		type inner struct {
+			A string
+			B string `authr:"b"`
+			C string
+		}
+		type other struct {
+			C string
+		}
+		sr := StructResource("thing", struct {
+			inner
+			other
+			A string
+		}{inner: inner{A: "inner", B: "tagged", C: "c1"}, other: other{C: "c2"}, A: "outer"})
+		av, err := sr.GetResourceAttribute("A")
+		require.Nil(t, err)
+		require.Equal(t, "outer", av)
+		av, err = sr.GetResourceAttribute("b")
+		require.Nil(t, err)
+		require.Equal(t, "tagged", av)
+		av, err = sr.GetResourceAttribute("C")
+		require.Nil(t, err)
+		require.Nil(t, av, "ambiguous fields should be hidden")
+	})
+}
+
+func BenchmarkStructResource(b *testing.B) {
+	type post struct {
+		ID      int    `authr:"id"`
+		OwnerID string `json:"owner_id"`
+	}
+	p := post{ID: 1, OwnerID: "u"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = StructResource("post", p).GetResourceAttribute("owner_id")
+	}
 }
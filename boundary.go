@@ -0,0 +1,131 @@
+package authr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type member struct {
+	name    string
+	subject Subject
+}
+
+// intersection is a Subject that is only allowed to do what every one of its
+// members is allowed to do. It cannot be flattened into a single list of
+// rules, so it is recognized and evaluated by the Authorizer.
+type intersection struct {
+	members []member
+}
+
+// GetRules retrieves the rules of every member and returns them as a single
+// rule standing for the whole intersection, so that an intersection can be
+// wrapped by subjects that call GetRules, like a cache. That rule is only
+// understood by an Authorizer, as the only rule of a subject or layer: it
+// cannot be combined with other rules, and it cannot be marshaled.
+func (i intersection) GetRules() ([]*Rule, error) {
+	members := make([]member, len(i.members))
+	for n, m := range i.members {
+		rules, err := m.subject.GetRules()
+		if err != nil {
+			return nil, err
+		}
+		members[n] = member{name: m.name, subject: RuleList(rules)}
+	}
+	return []*Rule{{members: members}}, nil
+}
+
+// keyedIntersection is an intersection of subjects that all have a key.
+type keyedIntersection struct {
+	intersection
+	key string
+}
+
+func (k keyedIntersection) SubjectKey() string {
+	return k.key
+}
+
+// asIntersection returns the intersection the subject is, if it is one.
+func asIntersection(s Subject) (intersection, bool) {
+	switch i := s.(type) {
+	case intersection:
+		return i, true
+	case keyedIntersection:
+		return i.intersection, true
+	}
+	return intersection{}, false
+}
+
+// rulesIntersection returns the intersection standing for the rules if they
+// were returned by the GetRules of an intersection.
+func rulesIntersection(rules []*Rule) (intersection, bool, error) {
+	for _, r := range rules {
+		if r.members == nil {
+			continue
+		}
+		if len(rules) > 1 {
+			return intersection{}, false, Error("the rules of an intersection of subjects cannot be combined with other rules")
+		}
+		return intersection{members: r.members}, true, nil
+	}
+	return intersection{}, false, nil
+}
+
+func newIntersection(members ...member) Subject {
+	for _, m := range members {
+		if m.subject == nil {
+			panic("authr: cannot intersect a nil subject")
+		}
+	}
+	keys := make([]string, len(members))
+	for n, m := range members {
+		ks, ok := m.subject.(KeyedSubject)
+		if !ok || ks.SubjectKey() == "" {
+			return intersection{members: members}
+		}
+		keys[n] = fmt.Sprintf("%s=%q", m.name, ks.SubjectKey())
+	}
+	return keyedIntersection{
+		intersection: intersection{members: members},
+		key:          "intersect(" + strings.Join(keys, ", ") + ")",
+	}
+}
+
+// Intersect returns a Subject that is allowed to perform an action only if
+// every one of the provided subjects independently allows it, using the
+// combining algorithm of the Authorizer for each. The members are named by
+// their index in a Decision. If every subject is a KeyedSubject, so is the
+// returned Subject, with a key combining theirs like `intersect(0="user:1",
+// 1="org:2")`. Intersect panics if no subjects are provided.
+func Intersect(subjects ...Subject) Subject {
+	if len(subjects) == 0 {
+		panic("authr: cannot intersect zero subjects")
+	}
+	members := make([]member, len(subjects))
+	for i, s := range subjects {
+		members[i] = member{name: strconv.Itoa(i), subject: s}
+	}
+	return newIntersection(members...)
+}
+
+// Bounded returns a Subject limited by a permission boundary: it is allowed to
+// perform an action only if both the subject and the boundary allow it. The
+// members are named "subject" and "boundary" in a Decision, and like with
+// Intersect, the returned Subject has a key if both of them do.
+func Bounded(s, boundary Subject) Subject {
+	return newIntersection(
+		member{name: "subject", subject: s},
+		member{name: "boundary", subject: boundary},
+	)
+}
+
+// Restrict returns a Subject scoped down from its parent, like an API token
+// created by a user: it is allowed to perform an action only if both the
+// parent and the additional rules allow it, so it can never do more than its
+// parent. The members are named "parent" and "restriction" in a Decision.
+func Restrict(parent Subject, rules ...*Rule) Subject {
+	return newIntersection(
+		member{name: "parent", subject: parent},
+		member{name: "restriction", subject: RuleList(rules)},
+	)
+}
@@ -0,0 +1,138 @@
+package authr
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntersection(t *testing.T) {
+	zoneRule := func(access Access, action string) *Rule {
+		return new(Rule).Access(access).Where(Action(action), ResourceType("zone"), ResourceMatch())
+	}
+	user := RuleList{
+		zoneRule(Allow, "read"),
+		zoneRule(Allow, "update"),
+		zoneRule(Allow, "delete"),
+	}
+	boundary := RuleList{
+		zoneRule(Deny, "delete"),
+		zoneRule(Allow, "*"),
+	}
+	zone := testResource{rtype: "zone"}
+
+	t.Run("should allow only what every subject allows", func(t *testing.T) {
+		s := Intersect(user, boundary, RuleList{zoneRule(Allow, "read")})
+		for action, want := range map[string]bool{"read": true, "update": false, "delete": false, "purge": false} {
+			ok, err := Can(s, action, zone)
+			require.Nil(t, err)
+			require.Equal(t, want, ok, action)
+		}
+	})
+	t.Run("should name the member that denied in a Decision", func(t *testing.T) {
+		d, err := Decide(Bounded(user, boundary), "delete", zone)
+		require.Nil(t, err)
+		require.Equal(t, Decision{Rule: boundary[0], RuleIndex: 0, Layer: "boundary"}, d)
+		require.Equal(t, `denied by rule 0 in "boundary"`, d.String())
+
+		d, err = Decide(Bounded(user, boundary), "purge", zone)
+		require.Nil(t, err)
+		require.Equal(t, Decision{RuleIndex: -1, Layer: "subject"}, d)
+		require.Equal(t, `denied, no rule matched in "subject"`, d.String())
+
+		d, err = Decide(Intersect(user, boundary, RuleList{}), "read", zone)
+		require.Nil(t, err)
+		require.Equal(t, Decision{RuleIndex: -1, Layer: "2"}, d)
+	})
+	t.Run("should attribute an allowed intersection to its first member", func(t *testing.T) {
+		d, err := Decide(Bounded(user, boundary), "update", zone)
+		require.Nil(t, err)
+		require.Equal(t, Decision{Allowed: true, Rule: user[1], RuleIndex: 1, Layer: "subject"}, d)
+	})
+	t.Run("should scope a subject down with Restrict", func(t *testing.T) {
+		token := Restrict(user, zoneRule(Allow, "read"), zoneRule(Allow, "purge"))
+		for action, want := range map[string]bool{"read": true, "update": false, "purge": false} {
+			ok, err := Can(token, action, zone)
+			require.Nil(t, err)
+			require.Equal(t, want, ok, action)
+		}
+		d, err := Decide(token, "purge", zone)
+		require.Nil(t, err)
+		require.Equal(t, "parent", d.Layer)
+	})
+	t.Run("should allow nested intersections", func(t *testing.T) {
+		token := Restrict(Bounded(user, boundary), zoneRule(Allow, "*"))
+		d, err := Decide(token, "delete", zone)
+		require.Nil(t, err)
+		require.False(t, d.Allowed)
+		require.Equal(t, "parent/boundary", d.Layer)
+	})
+	t.Run("should return errors from members", func(t *testing.T) {
+		d, err := Decide(Bounded(user, errSubject{}), "read", zone)
+		require.Equal(t, Error("subject error"), err)
+		require.Equal(t, Decision{RuleIndex: -1, Layer: "boundary"}, d)
+	})
+	t.Run("should decide intersections within layers", func(t *testing.T) {
+		a := NewAuthorizer(Layered(Layer{Name: "subject"}, Layer{Name: "fallback", Rules: StaticRules(zoneRule(Allow, "*"))}))
+		d, err := a.Decide(Bounded(user, boundary), "purge", zone)
+		require.Nil(t, err)
+		require.Equal(t, Decision{RuleIndex: -1, Layer: "subject/subject"}, d)
+	})
+	t.Run("should list the rules of an intersection as a single rule", func(t *testing.T) {
+		rules, err := Restrict(Bounded(user, boundary), zoneRule(Allow, "*")).GetRules()
+		require.Nil(t, err)
+		require.Len(t, rules, 1)
+		for _, action := range []string{"read", "update", "delete", "purge"} {
+			want, err := Decide(Restrict(Bounded(user, boundary), zoneRule(Allow, "*")), action, zone)
+			require.Nil(t, err)
+			d, err := Decide(RuleList(rules), action, zone)
+			require.Nil(t, err)
+			require.Equal(t, want, d, action)
+		}
+		d, err := NewAuthorizer(Layered(Layer{Name: "token", Rules: StaticRules(rules...)})).Decide(RuleList{}, "delete", zone)
+		require.Nil(t, err)
+		require.Equal(t, "token/parent/boundary", d.Layer)
+
+		e, err := PartialEval(RuleList(rules), "delete", "zone", nil)
+		require.Nil(t, err)
+		require.Equal(t, Constant(false), e)
+	})
+	t.Run("should not combine or marshal the rules of an intersection", func(t *testing.T) {
+		rules, err := Intersect(user).GetRules()
+		require.Nil(t, err)
+		_, err = Decide(append(RuleList{zoneRule(Allow, "*")}, rules...), "read", zone)
+		require.EqualError(t, err, "the rules of an intersection of subjects cannot be combined with other rules")
+		_, err = json.Marshal(rules[0])
+		require.NotNil(t, err)
+		require.Contains(t, err.Error(), "the rules of an intersection of subjects cannot be marshaled")
+	})
+	t.Run("should return errors from members when listing rules", func(t *testing.T) {
+		_, err := Bounded(user, errSubject{}).GetRules()
+		require.Equal(t, Error("subject error"), err)
+	})
+	t.Run("should have a key if every member has one", func(t *testing.T) {
+		s := Bounded(&keyedSubject{key: "user:1"}, &keyedSubject{key: "org:2"})
+		require.Implements(t, (*KeyedSubject)(nil), s)
+		require.Equal(t, `intersect(subject="user:1", boundary="org:2")`, s.(KeyedSubject).SubjectKey())
+		s = Intersect(&keyedSubject{key: "user:1"}, s)
+		require.Equal(t, `intersect(0="user:1", 1="intersect(subject=\"user:1\", boundary=\"org:2\")")`, s.(KeyedSubject).SubjectKey())
+
+		_, ok := Bounded(&keyedSubject{key: "user:1"}, boundary).(KeyedSubject)
+		require.False(t, ok)
+		_, ok = Restrict(&keyedSubject{key: "user:1"}).(KeyedSubject)
+		require.False(t, ok)
+		_, ok = Bounded(&keyedSubject{key: "user:1"}, &keyedSubject{}).(KeyedSubject)
+		require.False(t, ok)
+	})
+	t.Run("should panic on invalid intersections", func(t *testing.T) {
+		require.Panics(t, func() { Intersect() })
+		require.Panics(t, func() { Bounded(user, nil) })
+	})
+}
+
+type errSubject struct{}
+
+func (errSubject) GetRules() ([]*Rule, error) {
+	return nil, Error("subject error")
+}
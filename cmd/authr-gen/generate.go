@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultOutput = "authr_resource.go"
+	directive     = "//authr:resource"
+)
+
+type resource struct {
+	name, rsrcType string
+	fields         []field
+	// names are the fields resolved by their Go name, for the attributes
+	// that are not already resolved by a tag name
+	names []field
+}
+
+// field is an attribute of a resource and the selector path to the struct
+// field holding it.
+type field struct {
+	attr   string
+	path   []step
+	tagged bool
+}
+
+type step struct {
+	name string
+	// ptr is true if this step is an embedded pointer that must be checked
+	// for nil before going any deeper
+	ptr bool
+}
+
+type generator struct {
+	pkg     string
+	structs map[string]*ast.StructType
+	warn    io.Writer
+}
+
+// generate will parse the Go files in dir, excluding tests and the output file,
+// and return the source for the resources found. It returns nil if no structs
+// have the authr:resource directive.
+func generate(dir, output string, warn io.Writer) ([]byte, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	g := &generator{structs: make(map[string]*ast.StructType), warn: warn}
+	fset := token.NewFileSet()
+	var resources []*resource
+	for _, fn := range files {
+		base := filepath.Base(fn)
+		if strings.HasSuffix(base, "_test.go") || base == output {
+			continue
+		}
+		f, err := parser.ParseFile(fset, fn, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if g.pkg == "" {
+			g.pkg = f.Name.Name
+		} else if g.pkg != f.Name.Name {
+			return nil, fmt.Errorf("found packages %s and %s in %s", g.pkg, f.Name.Name, dir)
+		}
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				st, isStruct := ts.Type.(*ast.StructType)
+				if isStruct {
+					g.structs[ts.Name.Name] = st
+				}
+				doc := ts.Doc
+				if doc == nil && len(gd.Specs) == 1 {
+					doc = gd.Doc
+				}
+				rt, ok := resourceType(doc)
+				if !ok {
+					continue
+				}
+				pos := fset.Position(ts.Pos())
+				if !isStruct {
+					return nil, fmt.Errorf("%s: %s has an %s directive but is not a struct", pos, ts.Name.Name, directive)
+				}
+				if rt == "" {
+					return nil, fmt.Errorf("%s: %s directive on %s is missing a resource type", pos, directive, ts.Name.Name)
+				}
+				resources = append(resources, &resource{name: ts.Name.Name, rsrcType: rt})
+			}
+		}
+	}
+	if len(resources) == 0 {
+		return nil, nil
+	}
+	for _, r := range resources {
+		r.fields = g.fields(r.name, true)
+		attrs := make(map[string]bool, len(r.fields))
+		for _, f := range r.fields {
+			attrs[f.attr] = true
+		}
+		for _, f := range g.fields(r.name, false) {
+			if !attrs[f.attr] {
+				r.names = append(r.names, f)
+			}
+		}
+	}
+	return g.render(resources)
+}
+
+func resourceType(doc *ast.CommentGroup) (string, bool) {
+	if doc == nil {
+		return "", false
+	}
+	for _, c := range doc.List {
+		if c.Text == directive {
+			return "", true
+		}
+		if strings.HasPrefix(c.Text, directive+" ") {
+			return strings.TrimSpace(c.Text[len(directive):]), true
+		}
+	}
+	return "", false
+}
+
+// fields finds the attributes of a struct, following the same rules as
+// authrutil.StructResource. If useTags is false, the names given in struct
+// tags are ignored, but fields tagged `authr:"-"` are still hidden.
+func (g *generator) fields(name string, useTags bool) []field {
+	type embedded struct {
+		name string
+		path []step
+	}
+	var (
+		fields  []field
+		next    = []embedded{{name: name}}
+		visited = map[string]bool{}
+	)
+	for len(next) > 0 {
+		current := next
+		next = nil
+		for _, e := range current {
+			if visited[e.name] {
+				continue
+			}
+			visited[e.name] = true
+			for _, af := range g.structs[e.name].Fields.List {
+				tag := reflect.StructTag("")
+				if af.Tag != nil {
+					s, _ := strconv.Unquote(af.Tag.Value)
+					tag = reflect.StructTag(s)
+				}
+				attr, ok := tagName(tag)
+				if !ok {
+					continue
+				}
+				if !useTags {
+					attr = ""
+				}
+				if len(af.Names) > 0 {
+					for _, n := range af.Names {
+						if !ast.IsExported(n.Name) {
+							continue
+						}
+						f := field{attr: attr, path: appendStep(e.path, step{name: n.Name}), tagged: attr != ""}
+						if !f.tagged {
+							f.attr = n.Name
+						}
+						fields = append(fields, f)
+					}
+					continue
+				}
+
+				typ, ptr, local := embeddedType(af.Type)
+				_, isStruct := g.structs[typ]
+				isStruct = isStruct && local
+				exported := ast.IsExported(typ)
+				if !exported && !isStruct {
+					continue
+				}
+				path := appendStep(e.path, step{name: typ, ptr: ptr})
+				if attr == "" && isStruct {
+					next = append(next, embedded{name: typ, path: path})
+					continue
+				}
+				if !exported {
+					continue
+				}
+				if attr == "" && !local {
+					if !useTags {
+						continue
+					}
+					fmt.Fprintf(g.warn, "authr-gen: skipping embedded field %s in %s; its fields cannot be promoted, tag it to use it as an attribute\n", typ, e.name)
+					continue
+				}
+				f := field{attr: attr, path: path, tagged: attr != ""}
+				if !f.tagged {
+					f.attr = typ
+				}
+				fields = append(fields, f)
+			}
+		}
+	}
+
+	sort.SliceStable(fields, func(i, j int) bool {
+		if fields[i].attr != fields[j].attr {
+			return fields[i].attr < fields[j].attr
+		}
+		if len(fields[i].path) != len(fields[j].path) {
+			return len(fields[i].path) < len(fields[j].path)
+		}
+		return fields[i].tagged && !fields[j].tagged
+	})
+	dominant := fields[:0]
+	for i := 0; i < len(fields); {
+		j := i + 1
+		for j < len(fields) && fields[j].attr == fields[i].attr {
+			j++
+		}
+		if j-i == 1 || len(fields[i].path) < len(fields[i+1].path) || fields[i].tagged != fields[i+1].tagged {
+			dominant = append(dominant, fields[i])
+		}
+		i = j
+	}
+	return dominant
+}
+
+func appendStep(path []step, s step) []step {
+	p := make([]step, len(path)+1)
+	copy(p, path)
+	p[len(path)] = s
+	return p
+}
+
+// embeddedType returns the name of an embedded field's type, whether it is a
+// pointer and whether it is declared in the package being generated.
+func embeddedType(expr ast.Expr) (string, bool, bool) {
+	ptr := false
+	if star, ok := expr.(*ast.StarExpr); ok {
+		ptr = true
+		expr = star.X
+	}
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name, ptr, true
+	case *ast.SelectorExpr:
+		return t.Sel.Name, ptr, false
+	}
+	return "", ptr, false
+}
+
+// tagName returns the attribute name given to a field by its "authr" or "json"
+// struct tag, or false if the field is hidden with `authr:"-"`.
+func tagName(tag reflect.StructTag) (string, bool) {
+	if t, ok := tag.Lookup("authr"); ok {
+		if t == "-" {
+			return "", false
+		}
+		if name := strings.Split(t, ",")[0]; name != "" {
+			return name, true
+		}
+	}
+	if t, ok := tag.Lookup("json"); ok && t != "-" {
+		return strings.Split(t, ",")[0], true
+	}
+	return "", true
+}
+
+func (g *generator) render(resources []*resource) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by authr-gen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n\n", g.pkg)
+	fmt.Fprintf(&b, "import \"github.com/cloudflare/authr/v3\"\n")
+	for _, r := range resources {
+		consts := make([]string, len(r.fields))
+		seen := map[string]string{}
+		for i, f := range r.fields {
+			consts[i] = r.name + "Attr" + identifier(f.attr)
+			if other, ok := seen[consts[i]]; ok {
+				return nil, fmt.Errorf("attributes %q and %q of %s would both generate the constant %s", other, f.attr, r.name, consts[i])
+			}
+			seen[consts[i]] = f.attr
+		}
+
+		fmt.Fprintf(&b, "\n// %sResourceType is the \"rsrc_type\" of %s.\n", r.name, r.name)
+		fmt.Fprintf(&b, "const %sResourceType = %q\n", r.name, r.rsrcType)
+		if len(r.fields) > 0 {
+			fmt.Fprintf(&b, "\n// Attributes of %s, for referencing in rules built in Go.\nconst (\n", r.name)
+			for i, f := range r.fields {
+				fmt.Fprintf(&b, "%s = %q\n", consts[i], f.attr)
+			}
+			fmt.Fprintf(&b, ")\n")
+		}
+
+		recv := receiver(r.name)
+		fmt.Fprintf(&b, "\nvar _ authr.Resource = %s{}\n", r.name)
+		fmt.Fprintf(&b, "\n// GetResourceType implements authr.Resource.\n")
+		fmt.Fprintf(&b, "func (%s %s) GetResourceType() (string, error) {\nreturn %sResourceType, nil\n}\n", recv, r.name, r.name)
+		fmt.Fprintf(&b, "\n// GetResourceAttribute implements authr.Resource.\n")
+		fmt.Fprintf(&b, "func (%s %s) GetResourceAttribute(key string) (interface{}, error) {\n", recv, r.name)
+		if len(r.fields)+len(r.names) > 0 {
+			fmt.Fprintf(&b, "switch key {\n")
+			for i, f := range r.fields {
+				fmt.Fprintf(&b, "case %s:\n", consts[i])
+				renderField(&b, recv, f)
+			}
+			for _, f := range r.names {
+				fmt.Fprintf(&b, "case %q:\n", f.attr)
+				renderField(&b, recv, f)
+			}
+			fmt.Fprintf(&b, "}\n")
+		}
+		fmt.Fprintf(&b, "return nil, nil\n}\n")
+	}
+	return format.Source(b.Bytes())
+}
+
+// renderField writes the statements returning the field from the receiver,
+// or nil if an embedded pointer on the way is nil.
+func renderField(b *bytes.Buffer, recv string, f field) {
+	sel := recv
+	var nilChecks []string
+	for j, s := range f.path {
+		sel += "." + s.name
+		if s.ptr && j < len(f.path)-1 {
+			nilChecks = append(nilChecks, sel+" == nil")
+		}
+	}
+	if len(nilChecks) > 0 {
+		fmt.Fprintf(b, "if %s {\nreturn nil, nil\n}\n", strings.Join(nilChecks, " || "))
+	}
+	fmt.Fprintf(b, "return %s, nil\n", sel)
+}
+
+func receiver(name string) string {
+	for _, r := range name {
+		return string(unicode.ToLower(r))
+	}
+	return "r"
+}
+
+var initialisms = map[string]bool{
+	"api": true, "dns": true, "http": true, "id": true, "ip": true,
+	"json": true, "ttl": true, "uri": true, "url": true, "uuid": true,
+}
+
+// identifier turns an attribute name like "owner_id" into "OwnerID".
+func identifier(attr string) string {
+	parts := strings.FieldsFunc(attr, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var b strings.Builder
+	for _, p := range parts {
+		if initialisms[strings.ToLower(p)] {
+			b.WriteString(strings.ToUpper(p))
+			continue
+		}
+		rs := []rune(p)
+		rs[0] = unicode.ToUpper(rs[0])
+		b.WriteString(string(rs))
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
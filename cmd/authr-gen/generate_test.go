@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateExample(t *testing.T) {
+	dir := filepath.Join("internal", "example")
+	want, err := ioutil.ReadFile(filepath.Join(dir, defaultOutput))
+	require.Nil(t, err)
+	var warn bytes.Buffer
+	got, err := generate(dir, defaultOutput, &warn)
+	require.Nil(t, err)
+	require.Equal(t, string(want), string(got), "generated code is out of date, run go generate ./...")
+	require.Empty(t, warn.String())
+}
+
+func TestGenerate(t *testing.T) {
+	cases := []struct {
+		n     string
+		files map[string]string
+		err   string
+		warn  string
+		none  bool
+	}{
+		{
+			n:     "should generate nothing without directives",
+			files: map[string]string{"a.go": "package a\n\ntype A struct{ ID int }\n"},
+			none:  true,
+		},
+		{
+			n:     "should err when the directive is on a non-struct",
+			files: map[string]string{"a.go": "package a\n\n//authr:resource a\ntype A []string\n"},
+			err:   "a.go:4:6: A has an //authr:resource directive but is not a struct",
+		},
+		{
+			n:     "should err when the directive has no resource type",
+			files: map[string]string{"a.go": "package a\n\n//authr:resource\ntype A struct{}\n"},
+			err:   "a.go:4:6: //authr:resource directive on A is missing a resource type",
+		},
+		{
+			n: "should err on multiple packages",
+			files: map[string]string{
+				"a.go": "package a\n",
+				"b.go": "package b\n",
+			},
+			err: "found packages a and b in ",
+		},
+		{
+			n: "should err when two attributes generate the same constant",
+			files: map[string]string{
+				"a.go": "package a\n\n//authr:resource a\ntype A struct {\n\tX string `authr:\"owner_id\"`\n\tY string `authr:\"owner-id\"`\n}\n",
+			},
+			err: `attributes "owner-id" and "owner_id" of A would both generate the constant AAttrOwnerID`,
+		},
+		{
+			n: "should warn and skip embedded structs from other packages",
+			files: map[string]string{
+				"a.go": "package a\n\nimport \"time\"\n\n//authr:resource a\ntype A struct {\n\ttime.Time\n\tID int\n}\n",
+			},
+			warn: "authr-gen: skipping embedded field Time in A; its fields cannot be promoted, tag it to use it as an attribute\n",
+		},
+		{
+			n: "should ignore test files and the output file",
+			files: map[string]string{
+				"a_test.go":      "package a_test\n",
+				defaultOutput:    "package zzz\n",
+				"a.go":           "package a\n\n//authr:resource a\ntype A struct{}\n",
+				"unrelated.go.x": "nope",
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.n, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "authr-gen")
+			require.Nil(t, err)
+			defer os.RemoveAll(dir)
+			for name, src := range c.files {
+				require.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644))
+			}
+			var warn bytes.Buffer
+			got, err := generate(dir, defaultOutput, &warn)
+			if c.err != "" {
+				require.NotNil(t, err)
+				require.Contains(t, err.Error(), c.err)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, c.warn, warn.String())
+			if c.none {
+				require.Nil(t, got)
+			} else {
+				require.NotNil(t, got)
+			}
+		})
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	for attr, want := range map[string]string{
+		"owner_id":   "OwnerID",
+		"OwnerID":    "OwnerID",
+		"zone-name":  "ZoneName",
+		"api.url":    "APIURL",
+		"created_at": "CreatedAt",
+		"2fa":        "2fa",
+		"!!":         "_",
+	} {
+		require.Equal(t, want, identifier(attr), "identifier(%q)", attr)
+	}
+}
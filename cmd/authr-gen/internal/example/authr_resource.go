@@ -0,0 +1,102 @@
+// Code generated by authr-gen. DO NOT EDIT.
+
+package example
+
+import "github.com/cloudflare/authr/v3"
+
+// PostResourceType is the "rsrc_type" of Post.
+const PostResourceType = "post"
+
+// Attributes of Post, for referencing in rules built in Go.
+const (
+	PostAttrDraft    = "Draft"
+	PostAttrInternal = "Internal"
+	PostAttrAuthorID = "author_id"
+	PostAttrID       = "id"
+	PostAttrTags     = "tags"
+)
+
+var _ authr.Resource = Post{}
+
+// GetResourceType implements authr.Resource.
+func (p Post) GetResourceType() (string, error) {
+	return PostResourceType, nil
+}
+
+// GetResourceAttribute implements authr.Resource.
+func (p Post) GetResourceAttribute(key string) (interface{}, error) {
+	switch key {
+	case PostAttrDraft:
+		return p.Draft, nil
+	case PostAttrInternal:
+		return p.Internal, nil
+	case PostAttrAuthorID:
+		return p.AuthorID, nil
+	case PostAttrID:
+		return p.ID, nil
+	case PostAttrTags:
+		return p.Tags, nil
+	case "AuthorID":
+		return p.AuthorID, nil
+	case "ID":
+		return p.ID, nil
+	case "Tags":
+		return p.Tags, nil
+	}
+	return nil, nil
+}
+
+// ZoneResourceType is the "rsrc_type" of Zone.
+const ZoneResourceType = "zone"
+
+// Attributes of Zone, for referencing in rules built in Go.
+const (
+	ZoneAttrCreated   = "Created"
+	ZoneAttrCreatedBy = "created_by"
+	ZoneAttrLocked    = "locked"
+	ZoneAttrName      = "name"
+	ZoneAttrOwnerID   = "owner_id"
+	ZoneAttrUpdatedBy = "updated_by"
+)
+
+var _ authr.Resource = Zone{}
+
+// GetResourceType implements authr.Resource.
+func (z Zone) GetResourceType() (string, error) {
+	return ZoneResourceType, nil
+}
+
+// GetResourceAttribute implements authr.Resource.
+func (z Zone) GetResourceAttribute(key string) (interface{}, error) {
+	switch key {
+	case ZoneAttrCreated:
+		return z.Created, nil
+	case ZoneAttrCreatedBy:
+		return z.audit.CreatedBy, nil
+	case ZoneAttrLocked:
+		return z.Locked, nil
+	case ZoneAttrName:
+		return z.Name, nil
+	case ZoneAttrOwnerID:
+		if z.Owner == nil {
+			return nil, nil
+		}
+		return z.Owner.OwnerID, nil
+	case ZoneAttrUpdatedBy:
+		return z.UpdatedBy, nil
+	case "CreatedBy":
+		return z.audit.CreatedBy, nil
+	case "Locked":
+		return z.Locked, nil
+	case "Name":
+		return z.Name, nil
+	case "OwnerID":
+		if z.Owner == nil {
+			return nil, nil
+		}
+		return z.Owner.OwnerID, nil
+	case "UpdatedBy":
+		return z.UpdatedBy, nil
+	}
+	return nil, nil
+}
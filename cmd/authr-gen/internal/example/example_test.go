@@ -0,0 +1,49 @@
+package example
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudflare/authr/v3"
+	"github.com/cloudflare/authr/v3/authrutil"
+	"github.com/stretchr/testify/require"
+)
+
+// The generated resources must agree with authrutil.StructResource on every
+// attribute, including the ones that are hidden.
+func TestGeneratedMatchesStructResource(t *testing.T) {
+	keys := []string{
+		PostAttrID, PostAttrAuthorID, PostAttrTags, PostAttrDraft,
+		ZoneAttrCreated, ZoneAttrCreatedBy, ZoneAttrLocked, ZoneAttrName, ZoneAttrOwnerID, ZoneAttrUpdatedBy,
+		"ID", "AuthorID", "Tags", "Password", "Internal", "secret", "Owner", "OwnerID", "audit", "Name", "CreatedBy", "Locked", "UpdatedBy", "nope",
+	}
+	cases := []struct {
+		n   string
+		typ string
+		v   authr.Resource
+	}{
+		{n: "post", typ: PostResourceType, v: Post{ID: 1, AuthorID: "u1", Tags: []string{"a"}, Draft: true, Password: "p", Internal: "i", secret: "s"}},
+		{n: "zone with nil embedded pointer", typ: ZoneResourceType, v: Zone{
+			audit:     audit{CreatedBy: "u1", UpdatedBy: "shadowed"},
+			Name:      "example.com",
+			UpdatedBy: "u2",
+			Created:   time.Unix(0, 0),
+		}},
+		{n: "zone with embedded pointer", typ: ZoneResourceType, v: Zone{Owner: &Owner{OwnerID: "o1"}, Locked: true}},
+	}
+	for _, c := range cases {
+		t.Run(c.n, func(t *testing.T) {
+			typ, err := c.v.GetResourceType()
+			require.Nil(t, err)
+			require.Equal(t, c.typ, typ)
+			sr := authrutil.StructResource(c.typ, c.v)
+			for _, k := range keys {
+				want, err := sr.GetResourceAttribute(k)
+				require.Nil(t, err)
+				got, err := c.v.GetResourceAttribute(k)
+				require.Nil(t, err)
+				require.Equal(t, want, got, "attribute %q", k)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+// Package example holds structs for exercising authr-gen. The generated code
+// is checked in so that it is compiled and tested along with everything else.
+package example
+
+import "time"
+
+//go:generate go run github.com/cloudflare/authr/v3/cmd/authr-gen
+
+//authr:resource post
+type Post struct {
+	ID       int      `authr:"id"`
+	AuthorID string   `json:"author_id,omitempty"`
+	Tags     []string `json:"tags"`
+	Draft    bool
+	Password string `authr:"-"`
+	Internal string `json:"-"`
+	secret   string
+}
+
+type audit struct {
+	CreatedBy string `json:"created_by"`
+	UpdatedBy string `json:"updated_by"`
+}
+
+type Owner struct {
+	OwnerID string `authr:"owner_id"`
+}
+
+type (
+	// Zone has fields promoted from embedded structs.
+	//
+	//authr:resource zone
+	Zone struct {
+		audit
+		*Owner
+		Name      string `authr:"name"`
+		UpdatedBy string `authr:"updated_by"`
+		Locked    bool   `authr:"locked"`
+		Created   time.Time
+	}
+
+	// Record has no directive, so it is skipped.
+	Record struct {
+		Name string
+	}
+)
@@ -0,0 +1,64 @@
+// Command authr-gen generates reflection-free authr.Resource implementations
+// for structs.
+//
+// Structs are selected with an "authr:resource" directive naming the resource
+// type, and their attributes follow the same rules as authrutil.StructResource:
+// an "authr" struct tag, then a "json" struct tag, then the field name, which
+// also keeps resolving tagged fields. `authr:"-"` hides a field and fields of
+// embedded structs are promoted.
+//
+//	//go:generate go run github.com/cloudflare/authr/v3/cmd/authr-gen
+//
+//	//authr:resource post
+//	type Post struct {
+//	    ID      int    `authr:"id"`
+//	    OwnerID string `json:"owner_id"`
+//	}
+//
+// For every selected struct, a GetResourceType and GetResourceAttribute method
+// is generated along with a constant for the resource type and every
+// attribute name (PostResourceType, PostAttrID, PostAttrOwnerID), so that
+// rules built in Go can be checked at compile-time:
+//
+//	authr.Cond("@"+models.PostAttrOwnerID, "=", userID)
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	output := flag.String("o", defaultOutput, "name of the generated file, relative to the package directory")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: authr-gen [-o file] [package directory]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	dir := "."
+	switch flag.NArg() {
+	case 0:
+	case 1:
+		dir = flag.Arg(0)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	src, err := generate(dir, *output, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "authr-gen: %s\n", err)
+		os.Exit(1)
+	}
+	if src == nil {
+		fmt.Fprintf(os.Stderr, "authr-gen: no structs with an authr:resource directive found in %s\n", dir)
+		os.Exit(1)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, *output), src, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "authr-gen: %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,281 @@
+package authr
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// KeyedSubject is implemented by subjects that can be identified by a stable
+// key, which allows a DecisionCache to cache decisions about them. Subjects
+// with the same key must have the same rules. An empty key means the subject
+// cannot be identified, like a subject without a key, for wrappers that only
+// know at runtime whether the subject they wrap has one.
+type KeyedSubject interface {
+	SubjectKey() string
+}
+
+// VersionedResource is implemented by resources that can be fingerprinted,
+// which allows a DecisionCache to cache decisions about them. The version must
+// identify the resource and change whenever its type or attributes change,
+// like "zone:123@7".
+type VersionedResource interface {
+	ResourceVersion() string
+}
+
+// DecisionCacheOption configures a DecisionCache.
+type DecisionCacheOption func(*DecisionCache)
+
+// CacheTTL sets how long decisions are cached. The default is one minute.
+func CacheTTL(ttl time.Duration) DecisionCacheOption {
+	return func(c *DecisionCache) {
+		c.ttl = ttl
+	}
+}
+
+// CacheSize sets the maximum number of cached decisions, beyond which the
+// least recently used decisions are evicted. The default is 10000.
+func CacheSize(size int) DecisionCacheOption {
+	return func(c *DecisionCache) {
+		c.size = size
+	}
+}
+
+// CacheStats reports the activity of a DecisionCache since it was created.
+type CacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+
+	// Size is the number of decisions currently cached, including expired
+	// ones that have not been evicted yet.
+	Size int
+}
+
+// HitRate returns the ratio of lookups that were answered from the cache, or 0
+// if there were none.
+func (s CacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+type decisionCacheEntry struct {
+	key        string
+	subjectKey string
+	expires    time.Time
+	d          Decision
+}
+
+// DecisionCache answers the same questions as an Authorizer, but remembers its
+// decisions for attempts by a KeyedSubject on a VersionedResource. Attempts by
+// other subjects or on other resources, including resources passed to
+// CanWithEnv, are never cached. Errors, and decisions reached despite one (see
+// FallbackRules), are never cached either.
+//
+// Obligations are carried out on every call to Can, including when the
+// decision comes from the cache. Since a cached decision is not re-evaluated
+// until it expires, changes to a subject's rules, and rules whose validity
+// window starts or ends in the meantime, are only picked up after the TTL
+// unless the subject is invalidated. A DecisionCache is safe for concurrent
+// use.
+type DecisionCache struct {
+	// accessed atomically, first for 64-bit alignment on 32-bit platforms
+	hits, misses, evictions int64
+
+	a    *Authorizer
+	ttl  time.Duration
+	size int
+
+	mu sync.Mutex
+	// gen is incremented by every invalidation, so that decisions reached
+	// before an invalidation are not stored after it
+	gen       uint64
+	l         *list.List
+	entries   map[string]*list.Element
+	bySubject map[string]map[*list.Element]struct{}
+}
+
+// NewDecisionCache returns a DecisionCache in front of the provided Authorizer,
+// which also provides the clock used for expiring decisions. If the Authorizer
+// is nil, the cache answers like Can. It will panic if the TTL or size are not
+// positive.
+func NewDecisionCache(a *Authorizer, opts ...DecisionCacheOption) *DecisionCache {
+	if a == nil {
+		a = defaultAuthorizer
+	}
+	c := &DecisionCache{
+		a:         a,
+		ttl:       time.Minute,
+		size:      10000,
+		l:         list.New(),
+		entries:   make(map[string]*list.Element),
+		bySubject: make(map[string]map[*list.Element]struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.ttl <= 0 {
+		panic("authr: decision cache TTL must be positive")
+	}
+	if c.size <= 0 {
+		panic("authr: decision cache size must be positive")
+	}
+	return c
+}
+
+// Can is just like Authorizer.Can, except the decision may come from the
+// cache.
+func (c *DecisionCache) Can(s Subject, action string, r Resource) (bool, error) {
+	start := time.Now()
+	at := &attempt{action: action, r: r, now: c.a.now()}
+	d, cached, err := c.decide(s, at)
+	if err == nil {
+		err = c.a.fulfill(d, r)
+	}
+	c.a.observe(s, at, d, err, cached, start)
+	if err != nil {
+		return false, err
+	}
+	return d.Allowed, nil
+}
+
+// Decide is just like Authorizer.Decide, except the decision may come from the
+// cache.
+func (c *DecisionCache) Decide(s Subject, action string, r Resource) (Decision, error) {
+	start := time.Now()
+	at := &attempt{action: action, r: r, now: c.a.now()}
+	d, cached, err := c.decide(s, at)
+	c.a.observe(s, at, d, err, cached, start)
+	return d, err
+}
+
+// decide returns the decision for the attempt, and whether it came from the
+// cache.
+func (c *DecisionCache) decide(s Subject, at *attempt) (Decision, bool, error) {
+	ks, ok := s.(KeyedSubject)
+	if !ok {
+		d, err := c.a.decideAttempt(s, at)
+		return d, false, err
+	}
+	vr, ok := at.r.(VersionedResource)
+	if !ok {
+		d, err := c.a.decideAttempt(s, at)
+		return d, false, err
+	}
+	subjectKey := ks.SubjectKey()
+	if subjectKey == "" {
+		d, err := c.a.decideAttempt(s, at)
+		return d, false, err
+	}
+	key := cacheKey(subjectKey, at.action, vr.ResourceVersion())
+	d, gen, ok := c.lookup(key, at.now)
+	if ok {
+		atomic.AddInt64(&c.hits, 1)
+		return d, true, nil
+	}
+	atomic.AddInt64(&c.misses, 1)
+	d, err := c.a.decideAttempt(s, at)
+	if err != nil || d.Fallback != NoFallback {
+		return d, false, err
+	}
+	c.store(key, subjectKey, d, gen, at.now)
+	return d, false, nil
+}
+
+// Invalidate forgets every decision cached for the subject with the provided
+// key, for example after its rules changed.
+func (c *DecisionCache) Invalidate(subjectKey string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for e := range c.bySubject[subjectKey] {
+		c.remove(e)
+	}
+}
+
+// Purge forgets every cached decision.
+func (c *DecisionCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.l.Init()
+	c.entries = make(map[string]*list.Element)
+	c.bySubject = make(map[string]map[*list.Element]struct{})
+}
+
+// Stats returns the activity of the cache since it was created.
+func (c *DecisionCache) Stats() CacheStats {
+	c.mu.Lock()
+	size := c.l.Len()
+	c.mu.Unlock()
+	return CacheStats{
+		Hits:      atomic.LoadInt64(&c.hits),
+		Misses:    atomic.LoadInt64(&c.misses),
+		Evictions: atomic.LoadInt64(&c.evictions),
+		Size:      size,
+	}
+}
+
+func cacheKey(subjectKey, action, version string) string {
+	// lengths are included so that no two attempts share a key
+	return fmt.Sprintf("%d:%s%d:%s%s", len(subjectKey), subjectKey, len(action), action, version)
+}
+
+// lookup returns the cached decision for the key, if there is one that has not
+// expired, along with the current generation of the cache.
+func (c *DecisionCache) lookup(key string, now time.Time) (Decision, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return Decision{}, c.gen, false
+	}
+	entry := e.Value.(*decisionCacheEntry)
+	if !now.Before(entry.expires) {
+		c.remove(e)
+		return Decision{}, c.gen, false
+	}
+	c.l.MoveToFront(e)
+	return entry.d, c.gen, true
+}
+
+// store caches the decision for the key, unless the cache was invalidated
+// since the generation the decision was reached in.
+func (c *DecisionCache) store(key, subjectKey string, d Decision, gen uint64, now time.Time) {
+	expires := now.Add(c.ttl)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	if e, ok := c.entries[key]; ok {
+		entry := e.Value.(*decisionCacheEntry)
+		entry.expires, entry.d = expires, d
+		c.l.MoveToFront(e)
+		return
+	}
+	for c.l.Len() >= c.size {
+		c.remove(c.l.Back())
+		atomic.AddInt64(&c.evictions, 1)
+	}
+	e := c.l.PushFront(&decisionCacheEntry{key: key, subjectKey: subjectKey, expires: expires, d: d})
+	c.entries[key] = e
+	if c.bySubject[subjectKey] == nil {
+		c.bySubject[subjectKey] = make(map[*list.Element]struct{})
+	}
+	c.bySubject[subjectKey][e] = struct{}{}
+}
+
+// remove must be called with c.mu held.
+func (c *DecisionCache) remove(e *list.Element) {
+	entry := c.l.Remove(e).(*decisionCacheEntry)
+	delete(c.entries, entry.key)
+	delete(c.bySubject[entry.subjectKey], e)
+	if len(c.bySubject[entry.subjectKey]) == 0 {
+		delete(c.bySubject, entry.subjectKey)
+	}
+}
@@ -0,0 +1,194 @@
+package authr
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type keyedSubject struct {
+	key   string
+	rules []*Rule
+	calls int32
+}
+
+func (s *keyedSubject) SubjectKey() string {
+	return s.key
+}
+
+func (s *keyedSubject) GetRules() ([]*Rule, error) {
+	atomic.AddInt32(&s.calls, 1)
+	return s.rules, nil
+}
+
+type versionedResource struct {
+	testResource
+	version string
+}
+
+func (r versionedResource) ResourceVersion() string {
+	return r.version
+}
+
+func TestDecisionCache(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := NewAuthorizer(WithClock(func() time.Time { return now }))
+	rules := []*Rule{
+		new(Rule).Access(Allow).Where(Action("read"), ResourceType("zone"), ResourceMatch(Cond("@plan", "=", "ent"))),
+	}
+	zone := func(version, plan string) versionedResource {
+		return versionedResource{
+			testResource: testResource{rtype: "zone", attributes: map[string]interface{}{"plan": plan}},
+			version:      version,
+		}
+	}
+
+	t.Run("should answer from the cache until the decision expires", func(t *testing.T) {
+		c := NewDecisionCache(a, CacheTTL(time.Minute))
+		s := &keyedSubject{key: "user:1", rules: rules}
+		for i := 0; i < 3; i++ {
+			ok, err := c.Can(s, "read", zone("zone:1@1", "ent"))
+			require.Nil(t, err)
+			require.True(t, ok)
+		}
+		require.Equal(t, int32(1), s.calls)
+		require.Equal(t, CacheStats{Hits: 2, Misses: 1, Size: 1}, c.Stats())
+		require.InDelta(t, 2.0/3, c.Stats().HitRate(), 0.0001)
+
+		now = now.Add(time.Minute)
+		ok, err := c.Can(s, "read", zone("zone:1@1", "ent"))
+		require.Nil(t, err)
+		require.True(t, ok)
+		require.Equal(t, int32(2), s.calls)
+	})
+	t.Run("should key decisions by subject, action and resource version", func(t *testing.T) {
+		c := NewDecisionCache(a)
+		s := &keyedSubject{key: "user:1", rules: rules}
+		ok, err := c.Can(s, "read", zone("zone:1@1", "ent"))
+		require.Nil(t, err)
+		require.True(t, ok)
+		ok, err = c.Can(s, "read", zone("zone:1@2", "free"))
+		require.Nil(t, err)
+		require.False(t, ok)
+		ok, err = c.Can(s, "delete", zone("zone:1@1", "ent"))
+		require.Nil(t, err)
+		require.False(t, ok)
+		ok, err = c.Can(&keyedSubject{key: "user:2"}, "read", zone("zone:1@1", "ent"))
+		require.Nil(t, err)
+		require.False(t, ok)
+		require.Equal(t, CacheStats{Misses: 4, Size: 4}, c.Stats())
+	})
+	t.Run("should not cache without a subject key or resource version", func(t *testing.T) {
+		c := NewDecisionCache(a)
+		s := &keyedSubject{key: "user:1", rules: rules}
+		unkeyed := &keyedSubject{rules: rules}
+		for i := 0; i < 2; i++ {
+			ok, err := c.Can(RuleList(rules), "read", zone("zone:1@1", "ent"))
+			require.Nil(t, err)
+			require.True(t, ok)
+			ok, err = c.Can(s, "read", zone("zone:1@1", "ent").testResource)
+			require.Nil(t, err)
+			require.True(t, ok)
+			ok, err = c.Can(unkeyed, "read", zone("zone:1@1", "ent"))
+			require.Nil(t, err)
+			require.True(t, ok)
+		}
+		require.Equal(t, int32(2), s.calls)
+		require.Equal(t, int32(2), unkeyed.calls)
+		require.Equal(t, CacheStats{}, c.Stats())
+	})
+	t.Run("should not cache errors", func(t *testing.T) {
+		c := NewDecisionCache(a)
+		s := &keyedSubject{key: "user:1", rules: rules}
+		r := zone("zone:1@1", "ent")
+		r.rterr = Error("no type")
+		for i := 0; i < 2; i++ {
+			_, err := c.Can(s, "read", r)
+			require.Equal(t, Error("no type"), err)
+		}
+		require.Equal(t, CacheStats{Misses: 2}, c.Stats())
+	})
+	t.Run("should forget invalidated subjects", func(t *testing.T) {
+		c := NewDecisionCache(a)
+		s1 := &keyedSubject{key: "user:1", rules: rules}
+		s2 := &keyedSubject{key: "user:2", rules: rules}
+		for _, s := range []*keyedSubject{s1, s2} {
+			_, err := c.Can(s, "read", zone("zone:1@1", "ent"))
+			require.Nil(t, err)
+			_, err = c.Can(s, "read", zone("zone:2@1", "ent"))
+			require.Nil(t, err)
+		}
+		c.Invalidate("user:1")
+		require.Equal(t, 2, c.Stats().Size)
+
+		s1.rules = nil
+		ok, err := c.Can(s1, "read", zone("zone:1@1", "ent"))
+		require.Nil(t, err)
+		require.False(t, ok)
+		ok, err = c.Can(s2, "read", zone("zone:1@1", "ent"))
+		require.Nil(t, err)
+		require.True(t, ok)
+		require.Equal(t, int32(2), s2.calls)
+
+		c.Purge()
+		require.Equal(t, 0, c.Stats().Size)
+	})
+	t.Run("should evict the least recently used decisions", func(t *testing.T) {
+		c := NewDecisionCache(a, CacheSize(2))
+		s := &keyedSubject{key: "user:1", rules: rules}
+		for _, v := range []string{"zone:1@1", "zone:2@1", "zone:1@1", "zone:3@1", "zone:1@1", "zone:2@1"} {
+			_, err := c.Can(s, "read", zone(v, "ent"))
+			require.Nil(t, err)
+		}
+		require.Equal(t, CacheStats{Hits: 2, Misses: 4, Evictions: 2, Size: 2}, c.Stats())
+	})
+	t.Run("should carry out obligations of cached decisions", func(t *testing.T) {
+		var audited int
+		a := NewAuthorizer(WithObligationHandler("audit", func(Obligation, Resource, Environment) error {
+			audited++
+			return nil
+		}))
+		c := NewDecisionCache(a)
+		s := &keyedSubject{key: "user:1", rules: []*Rule{
+			new(Rule).Access(Allow).Obligations(Obligation{ID: "audit"}).Where(Action("read"), ResourceType("zone"), ResourceMatch()),
+		}}
+		for i := 0; i < 2; i++ {
+			ok, err := c.Can(s, "read", zone("zone:1@1", "ent"))
+			require.Nil(t, err)
+			require.True(t, ok)
+		}
+		require.Equal(t, 2, audited)
+		require.Equal(t, int32(1), s.calls)
+	})
+	t.Run("should be safe for concurrent use", func(t *testing.T) {
+		c := NewDecisionCache(nil, CacheSize(8))
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				s := &keyedSubject{key: fmt.Sprintf("user:%d", i%3), rules: rules}
+				for j := 0; j < 200; j++ {
+					ok, err := c.Can(s, "read", zone(fmt.Sprintf("zone:%d@1", j%10), "ent"))
+					require.Nil(t, err)
+					require.True(t, ok)
+					if j%50 == 0 {
+						c.Invalidate(s.key)
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+		stats := c.Stats()
+		require.Equal(t, int64(8*200), stats.Hits+stats.Misses)
+		require.True(t, stats.Size <= 8)
+	})
+	t.Run("should panic on invalid options", func(t *testing.T) {
+		require.Panics(t, func() { NewDecisionCache(nil, CacheTTL(0)) })
+		require.Panics(t, func() { NewDecisionCache(nil, CacheSize(-1)) })
+	})
+}
@@ -0,0 +1,111 @@
+package authr
+
+import "fmt"
+
+// Fallback describes how a Decision was reached despite an error retrieving
+// the rules or the resource type.
+type Fallback int
+
+const (
+	// NoFallback is the Fallback of decisions reached normally.
+	NoFallback Fallback = iota
+
+	// UsedFallbackRules is the Fallback of decisions reached with the rules
+	// provided to FallbackRules.
+	UsedFallbackRules
+
+	// FailedOpen is the Fallback of decisions allowed by FailOpen.
+	FailedOpen
+)
+
+func (f Fallback) String() string {
+	switch f {
+	case NoFallback:
+		return "no fallback"
+	case UsedFallbackRules:
+		return "fallback rules"
+	case FailedOpen:
+		return "failed open"
+	}
+	return fmt.Sprintf("Fallback(%d)", int(f))
+}
+
+// FallbackHook is called with every decision reached despite an error, which
+// is available as Decision.Cause, for example to log it.
+type FallbackHook func(s Subject, action string, r Resource, d Decision)
+
+// FallbackRules makes the Authorizer decide attempts with the provided rules
+// when the subject's rules, the rules of a Layer or the resource type cannot be
+// retrieved, instead of returning the error. If none of the fallback rules
+// match, the attempt is denied, unless its action is allowed by FailOpen.
+// Errors evaluating a rule are always returned.
+//
+// By default, an Authorizer fails closed: the answer is "no" along with the
+// error.
+func FallbackRules(rules ...*Rule) Option {
+	return func(a *Authorizer) {
+		a.fallbackRules = rules
+	}
+}
+
+// FailOpen makes the Authorizer allow attempts to perform one of the provided
+// actions when the subject's rules, the rules of a Layer or the resource type
+// cannot be retrieved, and any FallbackRules did not match or could not be
+// evaluated. Only actions that are safe to allow to anyone, like reads of
+// non-sensitive resources, should fail open. Actions are matched exactly.
+func FailOpen(actions ...string) Option {
+	return func(a *Authorizer) {
+		if a.failOpen == nil {
+			a.failOpen = make(map[string]bool, len(actions))
+		}
+		for _, action := range actions {
+			a.failOpen[action] = true
+		}
+	}
+}
+
+// WithFallbackHook sets the function called with every decision reached by
+// FallbackRules or FailOpen.
+func WithFallbackHook(h FallbackHook) Option {
+	return func(a *Authorizer) {
+		a.fallbackHook = h
+	}
+}
+
+// hasFallback reports whether attempts to perform the action can be decided
+// despite an error retrieving the rules or the resource type.
+func (a *Authorizer) hasFallback(action string) bool {
+	return a.fallbackRules != nil || a.failOpen[action]
+}
+
+// fallBack decides an attempt that failed with an error retrieving the rules
+// or the resource type, according to the fallback options.
+func (a *Authorizer) fallBack(s Subject, at *attempt, failed Decision, cause error) (Decision, error) {
+	if !a.hasFallback(at.action) {
+		return failed, cause
+	}
+	var (
+		d       Decision
+		opinion bool
+		err     = cause
+	)
+	if a.fallbackRules != nil {
+		d, opinion, err = a.decideRules(a.fallbackRules, at)
+	}
+	switch {
+	case err == nil && opinion:
+		d.Fallback = UsedFallbackRules
+	case a.failOpen[at.action]:
+		d = Decision{Allowed: true, RuleIndex: -1, Fallback: FailedOpen}
+	case err == nil:
+		d.Fallback = UsedFallbackRules
+	default:
+		return failed, cause
+	}
+	d.Cause = cause
+	if a.fallbackHook != nil {
+		r, _ := splitEnv(at.r)
+		a.fallbackHook(originalSubject(s), at.action, r, d)
+	}
+	return d, nil
+}
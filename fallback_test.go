@@ -0,0 +1,144 @@
+package authr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFallback(t *testing.T) {
+	emergency := new(Rule).Access(Allow).Where(Action("read"), ResourceType("zone"), ResourceMatch(Cond("@plan", "=", "ent")))
+	zone := testResource{rtype: "zone", attributes: map[string]interface{}{"plan": "ent"}}
+	freeZone := testResource{rtype: "zone", attributes: map[string]interface{}{"plan": "free"}}
+	untyped := testResource{rterr: Error("no type")}
+	broken := RuleList{new(Rule).Access(Allow).Where(Action("read"), ResourceType("zone"), ResourceMatch(Cond("@plan", "&", "ent")))}
+	subjectErr := Error("subject error")
+
+	t.Run("should fail closed by default", func(t *testing.T) {
+		d, err := NewAuthorizer().Decide(errSubject{}, "read", zone)
+		require.Equal(t, subjectErr, err)
+		require.Equal(t, Decision{RuleIndex: -1}, d)
+	})
+	t.Run("should decide with the fallback rules", func(t *testing.T) {
+		a := NewAuthorizer(FallbackRules(emergency))
+		d, err := a.Decide(errSubject{}, "read", zone)
+		require.Nil(t, err)
+		require.Equal(t, Decision{Allowed: true, Rule: emergency, RuleIndex: 0, Fallback: UsedFallbackRules, Cause: subjectErr}, d)
+		require.Equal(t, "allowed by rule 0 (fallback rules: subject error)", d.String())
+
+		d, err = a.Decide(errSubject{}, "read", freeZone)
+		require.Nil(t, err)
+		require.Equal(t, Decision{RuleIndex: -1, Fallback: UsedFallbackRules, Cause: subjectErr}, d)
+
+		ok, err := a.Can(RuleList{}, "read", freeZone)
+		require.Nil(t, err)
+		require.False(t, ok, "fallback rules should only be used on errors")
+	})
+	t.Run("should fail open only for the provided actions", func(t *testing.T) {
+		a := NewAuthorizer(FailOpen("read", "list"))
+		d, err := a.Decide(errSubject{}, "read", freeZone)
+		require.Nil(t, err)
+		require.Equal(t, Decision{Allowed: true, RuleIndex: -1, Fallback: FailedOpen, Cause: subjectErr}, d)
+		require.Equal(t, "allowed, no rule matched (failed open: subject error)", d.String())
+
+		_, err = a.Decide(errSubject{}, "delete", freeZone)
+		require.Equal(t, subjectErr, err)
+
+		ok, err := a.Can(RuleList{}, "read", untyped)
+		require.Nil(t, err)
+		require.True(t, ok, "should fail open if the resource type cannot be retrieved")
+	})
+	t.Run("should fail open when the fallback rules do not match or fail", func(t *testing.T) {
+		a := NewAuthorizer(FallbackRules(emergency), FailOpen("read"))
+		d, err := a.Decide(errSubject{}, "read", freeZone)
+		require.Nil(t, err)
+		require.Equal(t, FailedOpen, d.Fallback)
+
+		d, err = a.Decide(errSubject{}, "read", untyped)
+		require.Nil(t, err)
+		require.Equal(t, FailedOpen, d.Fallback)
+
+		d, err = a.Decide(errSubject{}, "read", zone)
+		require.Nil(t, err)
+		require.Equal(t, UsedFallbackRules, d.Fallback)
+
+		_, err = NewAuthorizer(FallbackRules(emergency)).Decide(RuleList{}, "read", untyped)
+		require.Equal(t, Error("no type"), err)
+	})
+	t.Run("should not fall back on errors evaluating rules", func(t *testing.T) {
+		a := NewAuthorizer(FallbackRules(emergency), FailOpen("read"))
+		_, err := a.Decide(broken, "read", zone)
+		require.NotNil(t, err)
+		require.Equal(t, "& operator expects both operands to be an array or slice, received string for left operand", err.Error())
+	})
+	t.Run("should fall back on errors retrieving the rules of a layer or an intersection", func(t *testing.T) {
+		a := NewAuthorizer(FailOpen("read"), Layered(
+			Layer{Name: "organization", Rules: func(Subject) ([]*Rule, error) { return nil, Error("org error") }},
+			Layer{Name: "subject", Terminal: true},
+		))
+		d, err := a.Decide(RuleList{}, "read", zone)
+		require.Nil(t, err)
+		require.Equal(t, Decision{Allowed: true, RuleIndex: -1, Fallback: FailedOpen, Cause: Error("org error")}, d)
+
+		d, err = NewAuthorizer(FailOpen("read")).Decide(Bounded(errSubject{}, RuleList{}), "read", zone)
+		require.Nil(t, err)
+		require.Equal(t, FailedOpen, d.Fallback)
+	})
+	t.Run("should call the hook with every fallback decision", func(t *testing.T) {
+		var decisions []Decision
+		a := NewAuthorizer(FailOpen("read"), WithFallbackHook(func(s Subject, action string, r Resource, d Decision) {
+			require.Equal(t, errSubject{}, s)
+			require.Equal(t, "read", action)
+			require.Equal(t, zone, r)
+			decisions = append(decisions, d)
+		}))
+		_, err := a.CanWithEnv(errSubject{}, "read", zone, Env{"ip": "127.0.0.1"})
+		require.Nil(t, err)
+		_, err = a.Can(RuleList{}, "read", zone)
+		require.Nil(t, err)
+		_, err = a.Can(errSubject{}, "delete", zone)
+		require.NotNil(t, err)
+		require.Equal(t, []Decision{{Allowed: true, RuleIndex: -1, Fallback: FailedOpen, Cause: subjectErr}}, decisions)
+	})
+	t.Run("should give the hook and observers the original subject when filtering", func(t *testing.T) {
+		s := keyedErrSubject{key: "user:1"}
+		var hooked []Subject
+		o := &recordingObserver{}
+		a := NewAuthorizer(
+			FailOpen("read"),
+			WithFallbackHook(func(s Subject, action string, r Resource, d Decision) {
+				hooked = append(hooked, s)
+			}),
+			WithDecisionObserver(o),
+		)
+		got, err := Filter(s, "read", []Resource{zone, freeZone}, func(r Resource) Resource { return r }, FilterAuthorizer(a))
+		require.Nil(t, err)
+		require.Len(t, got, 2)
+		require.Equal(t, []Subject{s, s}, hooked)
+		require.Len(t, o.events, 2)
+		for _, e := range o.events {
+			require.Equal(t, "user:1", e.SubjectKey)
+			require.Equal(t, FailedOpen, e.Decision.Fallback)
+		}
+	})
+	t.Run("should not cache fallback decisions", func(t *testing.T) {
+		c := NewDecisionCache(NewAuthorizer(FailOpen("read")))
+		s := &keyedSubject{key: "user:1"}
+		r := versionedResource{testResource: untyped, version: "zone:1@1"}
+		for i := 0; i < 2; i++ {
+			ok, err := c.Can(s, "read", r)
+			require.Nil(t, err)
+			require.True(t, ok)
+		}
+		require.Equal(t, CacheStats{Misses: 2}, c.Stats())
+	})
+}
+
+type keyedErrSubject struct {
+	errSubject
+	key string
+}
+
+func (s keyedErrSubject) SubjectKey() string {
+	return s.key
+}
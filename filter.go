@@ -0,0 +1,260 @@
+package authr
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// FilterOption configures Filter.
+type FilterOption func(*filterConfig)
+
+type filterConfig struct {
+	authorizer *Authorizer
+	env        Environment
+	workers    int
+	threshold  int
+	failFast   bool
+}
+
+// FilterAuthorizer makes Filter answer with the provided Authorizer instead of
+// Can.
+func FilterAuthorizer(a *Authorizer) FilterOption {
+	return func(c *filterConfig) {
+		c.authorizer = a
+	}
+}
+
+// FilterEnv makes Filter answer like CanWithEnv with the provided Environment.
+func FilterEnv(env Environment) FilterOption {
+	return func(c *filterConfig) {
+		c.env = env
+	}
+}
+
+// FilterWorkers sets the maximum number of items evaluated concurrently. The
+// default is runtime.GOMAXPROCS(0).
+func FilterWorkers(n int) FilterOption {
+	return func(c *filterConfig) {
+		c.workers = n
+	}
+}
+
+// FilterParallelThreshold sets the number of items from which Filter evaluates
+// them concurrently, smaller slices are evaluated in a single goroutine. The
+// default is 64.
+func FilterParallelThreshold(n int) FilterOption {
+	return func(c *filterConfig) {
+		c.threshold = n
+	}
+}
+
+// FilterFailFast makes Filter stop at the first item that fails to evaluate
+// and return only that error, instead of evaluating every item.
+func FilterFailFast() FilterOption {
+	return func(c *filterConfig) {
+		c.failFast = true
+	}
+}
+
+// ItemError is the error that occurred evaluating the item at Index.
+type ItemError struct {
+	Index int
+	Err   error
+}
+
+func (e ItemError) Error() string {
+	return fmt.Sprintf("item %d: %s", e.Index, e.Err)
+}
+
+// FilterErrors lists the items that failed to evaluate in Filter, ordered by
+// index.
+type FilterErrors []ItemError
+
+func (e FilterErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, ie := range e {
+		msgs[i] = ie.Error()
+	}
+	return fmt.Sprintf("%d item(s) failed to evaluate: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// Filter returns the items the subject can perform the action on, in their
+// original order. The subject's rules, and the rules of every Layer of the
+// Authorizer, are retrieved at most once for the whole slice, and large slices
+// are evaluated concurrently by a bounded number of workers.
+//
+// Items that fail to evaluate are left out, and their errors are returned as
+// FilterErrors along with the items that were allowed. With FilterFailFast, the
+// first error is returned as an ItemError instead, along with no items.
+func Filter[T any](s Subject, action string, items []T, toResource func(T) Resource, opts ...FilterOption) ([]T, error) {
+	c := filterConfig{
+		authorizer: defaultAuthorizer,
+		workers:    runtime.GOMAXPROCS(0),
+		threshold:  64,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if c.workers < 1 {
+		c.workers = 1
+	}
+	s, err := snapshot(s, c.authorizer, action)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := make([]bool, len(items))
+	errs := make([]error, len(items))
+	var (
+		mu     sync.Mutex
+		failed = -1
+	)
+	evaluate := func(i int) bool {
+		var r Resource = toResource(items[i])
+		if c.env != nil {
+			r = envResource{Resource: r, env: c.env}
+		}
+		allowed[i], errs[i] = c.authorizer.Can(s, action, r)
+		if errs[i] == nil || !c.failFast {
+			return true
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if failed < 0 || i < failed {
+			failed = i
+		}
+		return false
+	}
+
+	if len(items) < c.threshold || c.workers == 1 {
+		for i := range items {
+			if !evaluate(i) {
+				break
+			}
+		}
+	} else {
+		var (
+			wg   sync.WaitGroup
+			next = make(chan int)
+			done = make(chan struct{})
+			once sync.Once
+		)
+		for w := 0; w < c.workers && w < len(items); w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range next {
+					if !evaluate(i) {
+						once.Do(func() { close(done) })
+					}
+				}
+			}()
+		}
+	feed:
+		for i := range items {
+			select {
+			case next <- i:
+			case <-done:
+				break feed
+			}
+		}
+		close(next)
+		wg.Wait()
+	}
+
+	if failed >= 0 {
+		return nil, ItemError{Index: failed, Err: errs[failed]}
+	}
+	var ferrs FilterErrors
+	result := make([]T, 0, len(items))
+	for i, item := range items {
+		if errs[i] != nil {
+			ferrs = append(ferrs, ItemError{Index: i, Err: errs[i]})
+			continue
+		}
+		if allowed[i] {
+			result = append(result, item)
+		}
+	}
+	if ferrs != nil {
+		return result, ferrs
+	}
+	return result, nil
+}
+
+// snapshot makes the subject's rules, and the rules of every layer of the
+// Authorizer, only be retrieved once for all the attempts by the returned
+// subject. Without layers, the subject's rules are retrieved right away and an
+// error is returned, unless the Authorizer can fall back on it. With layers,
+// rules are only retrieved once an attempt needs them, since a layer deciding
+// every attempt may leave the others unused, and errors are returned by every
+// attempt that needed them.
+func snapshot(s Subject, a *Authorizer, action string) (Subject, error) {
+	ss := snapshotSubject{Subject: s, rules: &lazyRules{load: s.GetRules}}
+	if a.layers == nil {
+		if _, err := ss.rules.get(); err != nil && !a.hasFallback(action) {
+			return nil, err
+		}
+		return ss, nil
+	}
+	ss.layers = make([]*lazyRules, len(a.layers))
+	for n, l := range a.layers {
+		if l.Rules == nil {
+			continue
+		}
+		rules := l.Rules
+		ss.layers[n] = &lazyRules{load: func() ([]*Rule, error) {
+			return rules(s)
+		}}
+	}
+	return ss, nil
+}
+
+// lazyRules retrieves rules once, when they are first needed.
+type lazyRules struct {
+	once  sync.Once
+	load  func() ([]*Rule, error)
+	rules []*Rule
+	err   error
+}
+
+func (l *lazyRules) get() ([]*Rule, error) {
+	l.once.Do(func() {
+		l.rules, l.err = l.load()
+	})
+	return l.rules, l.err
+}
+
+// snapshotSubject is a subject whose rules were retrieved by snapshot. It only
+// stands in for the subject's GetRules, and for the rules of the layers of the
+// Authorizer it was taken for: everything else, like a Layer or the key of the
+// subject, is given the original subject, see originalSubject.
+type snapshotSubject struct {
+	Subject
+	rules  *lazyRules
+	layers []*lazyRules
+}
+
+func (s snapshotSubject) GetRules() ([]*Rule, error) {
+	return s.rules.get()
+}
+
+// originalSubject returns the subject a snapshot was taken of, or the subject
+// itself if it is not a snapshot.
+func originalSubject(s Subject) Subject {
+	if ss, ok := s.(snapshotSubject); ok {
+		return ss.Subject
+	}
+	return s
+}
+
+// layerRules returns the rules of the layer at index n for the subject, which
+// are only retrieved once if the subject is a snapshot.
+func layerRules(s Subject, n int, l Layer) ([]*Rule, error) {
+	if ss, ok := s.(snapshotSubject); ok && ss.layers != nil {
+		return ss.layers[n].get()
+	}
+	return l.Rules(s)
+}
@@ -0,0 +1,176 @@
+package authr
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type countingSubject struct {
+	rules []*Rule
+	calls int32
+}
+
+func (s *countingSubject) GetRules() ([]*Rule, error) {
+	atomic.AddInt32(&s.calls, 1)
+	return s.rules, nil
+}
+
+type zone struct {
+	id     int
+	plan   string
+	broken bool
+}
+
+func zoneResource(z zone) Resource {
+	r := testResource{rtype: "zone", attributes: map[string]interface{}{"id": z.id, "plan": z.plan}}
+	if z.broken {
+		r.raerr = errors.New("broken zone")
+	}
+	return r
+}
+
+func TestFilter(t *testing.T) {
+	rules := []*Rule{
+		new(Rule).Access(Allow).Where(Action("read"), ResourceType("zone"), ResourceMatch(Cond("@plan", "=", "ent"))),
+	}
+	zones := make([]zone, 1000)
+	for i := range zones {
+		zones[i] = zone{id: i, plan: "free"}
+		if i%3 == 0 {
+			zones[i].plan = "ent"
+		}
+	}
+	var want []zone
+	for _, z := range zones {
+		if z.plan == "ent" {
+			want = append(want, z)
+		}
+	}
+
+	t.Run("should keep allowed items in order", func(t *testing.T) {
+		for _, workers := range []int{1, 4, 100} {
+			got, err := Filter(RuleList(rules), "read", zones, zoneResource, FilterWorkers(workers))
+			require.Nil(t, err)
+			require.Equal(t, want, got)
+		}
+	})
+	t.Run("should retrieve the rules only once", func(t *testing.T) {
+		s := &countingSubject{rules: rules}
+		_, err := Filter(s, "read", zones, zoneResource)
+		require.Nil(t, err)
+		require.Equal(t, int32(1), s.calls)
+
+		b := &countingSubject{rules: []*Rule{new(Rule).Access(Allow).Where(Action("*"), ResourceType("*"), ResourceMatch())}}
+		got, err := Filter(Bounded(s, b), "read", zones, zoneResource)
+		require.Nil(t, err)
+		require.Equal(t, want, got)
+		require.Equal(t, int32(2), s.calls)
+		require.Equal(t, int32(1), b.calls)
+	})
+	t.Run("should give layers and observers the original subject", func(t *testing.T) {
+		s := &keyedSubject{key: "user:1", rules: rules}
+		orgRules := func(s Subject) ([]*Rule, error) {
+			if _, ok := s.(*keyedSubject); !ok {
+				return nil, Error(fmt.Sprintf("unexpected subject %T", s))
+			}
+			return []*Rule{new(Rule).Access(Deny).Where(Action("read"), ResourceType("zone"), ResourceMatch(Cond("@id", "=", 3)))}, nil
+		}
+		o := &recordingObserver{}
+		a := NewAuthorizer(
+			Layered(Layer{Name: "organization", Rules: orgRules}, Layer{Name: "subject"}),
+			WithDecisionObserver(o),
+		)
+		got, err := Filter(s, "read", zones[:7], zoneResource, FilterAuthorizer(a))
+		require.Nil(t, err)
+		require.Equal(t, []zone{zones[0], zones[6]}, got)
+		require.Equal(t, int32(1), s.calls)
+		require.Len(t, o.events, 7)
+		for _, e := range o.events {
+			require.Equal(t, "user:1", e.SubjectKey)
+		}
+	})
+	t.Run("should retrieve the rules of layers only once", func(t *testing.T) {
+		var calls int32
+		orgRules := func(s Subject) ([]*Rule, error) {
+			atomic.AddInt32(&calls, 1)
+			return rules, nil
+		}
+		a := NewAuthorizer(Layered(Layer{Name: "organization", Rules: orgRules, Terminal: true}, Layer{Name: "subject"}))
+		for _, workers := range []int{1, 100} {
+			calls = 0
+			s := &countingSubject{rules: rules}
+			got, err := Filter(s, "read", zones, zoneResource, FilterAuthorizer(a), FilterWorkers(workers))
+			require.Nil(t, err)
+			require.Equal(t, want, got)
+			require.Equal(t, int32(1), calls)
+			require.Equal(t, int32(0), s.calls)
+		}
+
+		got, err := Filter(errSubject{}, "read", zones, zoneResource, FilterAuthorizer(a))
+		require.Nil(t, err)
+		require.Equal(t, want, got)
+	})
+	t.Run("should return an empty slice if nothing is allowed", func(t *testing.T) {
+		got, err := Filter(RuleList(rules), "delete", zones, zoneResource)
+		require.Nil(t, err)
+		require.Equal(t, []zone{}, got)
+	})
+	t.Run("should err if the rules cannot be retrieved", func(t *testing.T) {
+		got, err := Filter(errSubject{}, "read", zones, zoneResource)
+		require.NotNil(t, err)
+		require.Nil(t, got)
+	})
+	t.Run("should fall back if the rules cannot be retrieved", func(t *testing.T) {
+		a := NewAuthorizer(FallbackRules(rules...))
+		got, err := Filter(errSubject{}, "read", zones, zoneResource, FilterAuthorizer(a))
+		require.Nil(t, err)
+		require.Equal(t, want, got)
+	})
+	t.Run("should use the provided Authorizer and Environment", func(t *testing.T) {
+		rules := RuleList{
+			new(Rule).Access(Allow).Where(Action("read"), ResourceType("zone"), ResourceMatch(Cond("@plan", "=", "$env.plan"))),
+			new(Rule).Access(Deny).Where(Action("read"), ResourceType("zone"), ResourceMatch(Cond("@id", "=", 3))),
+		}
+		got, err := Filter(rules, "read", zones[:7], zoneResource, FilterEnv(Env{"plan": "ent"}))
+		require.Nil(t, err)
+		require.Equal(t, []zone{zones[0], zones[3], zones[6]}, got)
+
+		got, err = Filter(rules, "read", zones[:7], zoneResource, FilterEnv(Env{"plan": "ent"}), FilterAuthorizer(NewAuthorizer(WithCombiningAlgorithm(DenyOverrides))))
+		require.Nil(t, err)
+		require.Equal(t, []zone{zones[0], zones[6]}, got)
+	})
+
+	broken := make([]zone, len(zones))
+	copy(broken, zones)
+	broken[300].broken = true
+	broken[600].broken = true
+	for _, threshold := range []int{0, 1 << 20} {
+		opt := FilterParallelThreshold(threshold)
+		t.Run("should leave out and report the items that fail to evaluate", func(t *testing.T) {
+			got, err := Filter(RuleList(rules), "read", broken, zoneResource, opt)
+			require.NotNil(t, err)
+			require.Equal(t, "2 item(s) failed to evaluate: item 300: broken zone; item 600: broken zone", err.Error())
+			ferrs, ok := err.(FilterErrors)
+			require.True(t, ok)
+			require.Equal(t, []int{300, 600}, []int{ferrs[0].Index, ferrs[1].Index})
+			require.Equal(t, len(want)-2, len(got))
+			require.NotContains(t, got, broken[300])
+			require.NotContains(t, got, broken[600])
+		})
+		t.Run("should stop at the first error when failing fast", func(t *testing.T) {
+			got, err := Filter(RuleList(rules), "read", broken, zoneResource, opt, FilterFailFast(), FilterWorkers(1))
+			require.Nil(t, got)
+			require.Equal(t, ItemError{Index: 300, Err: errors.New("broken zone")}, err)
+
+			got, err = Filter(RuleList(rules), "read", broken, zoneResource, opt, FilterFailFast())
+			require.Nil(t, got)
+			ierr, ok := err.(ItemError)
+			require.True(t, ok)
+			require.Contains(t, []int{300, 600}, ierr.Index)
+		})
+	}
+}
@@ -3,17 +3,33 @@ package authr
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
+	propID             = "id"
+	propVersion        = "version"
 	propAccess         = "access"
+	propPriority       = "priority"
+	propNotBefore      = "not_before"
+	propNotAfter       = "not_after"
+	propObligations    = "obligations"
+	propObligationID   = "id"
+	propObligationArgs = "params"
+	propReason         = "reason"
+	propReasonCode     = "code"
+	propReasonMessage  = "message"
 	propWhere          = "where"
 	propWhereRsrcType  = "rsrc_type"
 	propWhereRsrcMatch = "rsrc_match"
 	propWhereAction    = "action"
 	propMeta           = "$meta"
+	propFn             = "$fn"
+	propFnArgs         = "args"
+	propParam          = "$param"
 
 	jtypeBool   = "JSON boolean"
 	jtypeNumber = "JSON number"
@@ -74,12 +90,279 @@ func (r *Rule) UnmarshalJSON(data []byte) error {
 	} else {
 		return jsonMissingProperty([]string{propWhere})
 	}
+	if ii, ok := o[propID]; ok {
+		id, ok := ii.(string)
+		if !ok {
+			return jsonInvalidType([]string{propID}, ii, jtypeString)
+		}
+		if id == "" {
+			return jsonInvalidPropValue([]string{propID}, "non-empty string", "empty string")
+		}
+		r.id = id
+	}
+	if vi, ok := o[propVersion]; ok {
+		v, ok := vi.(float64)
+		if !ok {
+			return jsonInvalidType([]string{propVersion}, vi, jtypeNumber)
+		}
+		if v != math.Trunc(v) || v < 0 || v > math.MaxInt32 {
+			return jsonInvalidPropValue([]string{propVersion}, "non-negative integer", fmt.Sprintf("%v", v))
+		}
+		r.version = int(v)
+	}
+	if pi, ok := o[propPriority]; ok {
+		p, ok := pi.(float64)
+		if !ok {
+			return jsonInvalidType([]string{propPriority}, pi, jtypeNumber)
+		}
+		if p != math.Trunc(p) || math.Abs(p) > math.MaxInt32 {
+			return jsonInvalidPropValue([]string{propPriority}, "integer", fmt.Sprintf("%v", p))
+		}
+		r.priority = int(p)
+	}
+	var err error
+	if r.notBefore, err = unmarshalTime(propNotBefore, o); err != nil {
+		return err
+	}
+	if r.notAfter, err = unmarshalTime(propNotAfter, o); err != nil {
+		return err
+	}
+	if !r.notBefore.IsZero() && !r.notAfter.IsZero() && !r.notAfter.After(r.notBefore) {
+		return jsonInvalidPropValue([]string{propNotAfter}, fmt.Sprintf(`time after "%s"`, propNotBefore), fmt.Sprintf(`"%s"`, o[propNotAfter]))
+	}
+	if oi, ok := o[propObligations]; ok {
+		if r.obligations, err = unmarshalObligations(oi); err != nil {
+			return err
+		}
+	}
+	if ri, ok := o[propReason]; ok {
+		if r.reason, err = unmarshalReason(ri); err != nil {
+			return err
+		}
+	}
 	if meta, ok := o[propMeta]; ok {
 		r.meta = meta
 	}
 	return nil
 }
 
+func unmarshalReason(ri interface{}) (Reason, error) {
+	o, ok := ri.(map[string]interface{})
+	if !ok {
+		return Reason{}, jsonInvalidType([]string{propReason}, ri, jtypeObject)
+	}
+	var reason Reason
+	for k, v := range o {
+		var dst *string
+		switch k {
+		case propReasonCode:
+			dst = &reason.Code
+		case propReasonMessage:
+			dst = &reason.Message
+		default:
+			return Reason{}, Error(fmt.Sprintf(
+				`invalid value for property "%s": unexpected key "%s" in reason, expected only "%s" and "%s"`,
+				propReason, k, propReasonCode, propReasonMessage,
+			))
+		}
+		if *dst, ok = v.(string); !ok {
+			return Reason{}, jsonInvalidType([]string{propReason, k}, v, jtypeString)
+		}
+	}
+	if reason.IsZero() {
+		return Reason{}, jsonInvalidPropValue([]string{propReason}, fmt.Sprintf(`non-empty "%s" or "%s"`, propReasonCode, propReasonMessage), "neither")
+	}
+	return reason, nil
+}
+
+func unmarshalObligations(oi interface{}) ([]Obligation, error) {
+	arr, ok := oi.([]interface{})
+	if !ok {
+		return nil, jsonInvalidType([]string{propObligations}, oi, jtypeArray)
+	}
+	obligations := make([]Obligation, len(arr))
+	for i, v := range arr {
+		path := []string{propObligations, strconv.Itoa(i)}
+		o, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, jsonInvalidType(path, v, jtypeObject)
+		}
+		for k := range o {
+			if k != propObligationID && k != propObligationArgs {
+				return nil, Error(fmt.Sprintf(
+					`invalid value for property "%s": unexpected key "%s" in obligation, expected only "%s" and "%s"`,
+					strings.Join(path, "."), k, propObligationID, propObligationArgs,
+				))
+			}
+		}
+		idi, ok := o[propObligationID]
+		if !ok {
+			return nil, jsonMissingProperty(append(path, propObligationID))
+		}
+		id, ok := idi.(string)
+		if !ok {
+			return nil, jsonInvalidType(append(path, propObligationID), idi, jtypeString)
+		}
+		if id == "" {
+			return nil, jsonInvalidPropValue(append(path, propObligationID), "non-empty string", "empty string")
+		}
+		obligations[i].ID = id
+		if pi, ok := o[propObligationArgs]; ok {
+			if obligations[i].Params, ok = pi.(map[string]interface{}); !ok {
+				return nil, jsonInvalidType(append(path, propObligationArgs), pi, jtypeObject)
+			}
+		}
+	}
+	return obligations, nil
+}
+
+func unmarshalTime(prop string, o map[string]interface{}) (time.Time, error) {
+	ti, ok := o[prop]
+	if !ok {
+		return time.Time{}, nil
+	}
+	ts, ok := ti.(string)
+	if !ok {
+		return time.Time{}, jsonInvalidType([]string{prop}, ti, jtypeString)
+	}
+	t, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return time.Time{}, jsonInvalidPropValue([]string{prop}, "RFC 3339 time", fmt.Sprintf(`"%s"`, ts))
+	}
+	return t, nil
+}
+
+type jsonRule struct {
+	ID          string           `json:"id,omitempty"`
+	Version     int              `json:"version,omitempty"`
+	Access      Access           `json:"access"`
+	Priority    int              `json:"priority,omitempty"`
+	NotBefore   string           `json:"not_before,omitempty"`
+	NotAfter    string           `json:"not_after,omitempty"`
+	Where       jsonWhere        `json:"where"`
+	Obligations []jsonObligation `json:"obligations,omitempty"`
+	Reason      *jsonReason      `json:"reason,omitempty"`
+	Meta        interface{}      `json:"$meta,omitempty"`
+}
+
+type jsonReason struct {
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type jsonObligation struct {
+	ID     string                 `json:"id"`
+	Params map[string]interface{} `json:"params,omitempty"`
+}
+
+type jsonWhere struct {
+	ResourceType  interface{} `json:"rsrc_type"`
+	ResourceMatch interface{} `json:"rsrc_match"`
+	Action        interface{} `json:"action"`
+}
+
+// MarshalJSON encodes the rule in the same format accepted by UnmarshalJSON.
+// Rules containing predicates created with Custom cannot be encoded, since
+// they have no registered name.
+func (r Rule) MarshalJSON() ([]byte, error) {
+	if r.members != nil {
+		return nil, Error("the rules of an intersection of subjects cannot be marshaled")
+	}
+	cs, err := marshalConditionSet(r.where.resourceMatch)
+	if err != nil {
+		return nil, err
+	}
+	jr := jsonRule{
+		ID:       r.id,
+		Version:  r.version,
+		Access:   r.access,
+		Priority: r.priority,
+		Where: jsonWhere{
+			ResourceType:  marshalSlugSet(r.where.resourceType),
+			ResourceMatch: cs,
+			Action:        marshalSlugSet(r.where.action),
+		},
+		Meta: r.meta,
+	}
+	if !r.reason.IsZero() {
+		jr.Reason = &jsonReason{Code: r.reason.Code, Message: r.reason.Message}
+	}
+	for _, o := range r.obligations {
+		jr.Obligations = append(jr.Obligations, jsonObligation{ID: o.ID, Params: o.Params})
+	}
+	if !r.notBefore.IsZero() {
+		jr.NotBefore = r.notBefore.Format(time.RFC3339Nano)
+	}
+	if !r.notAfter.IsZero() {
+		jr.NotAfter = r.notAfter.Format(time.RFC3339Nano)
+	}
+	return json.Marshal(jr)
+}
+
+func marshalSlugSet(ss SlugSet) interface{} {
+	elements := ss.elements
+	if elements == nil {
+		elements = []string{}
+	}
+	switch ss.mode {
+	case Wildcard:
+		return "*"
+	case Blocklist:
+		return map[string]interface{}{"$not": elements}
+	}
+	return elements
+}
+
+func marshalConditionSet(cs ConditionSet) (interface{}, error) {
+	evals := make([]interface{}, len(cs.evaluators))
+	for i, e := range cs.evaluators {
+		switch n := e.(type) {
+		case ConditionSet:
+			v, err := marshalConditionSet(n)
+			if err != nil {
+				return nil, err
+			}
+			evals[i] = v
+		case condition:
+			evals[i] = []interface{}{marshalOperand(n.left), n.op, marshalOperand(n.right)}
+		case predicate:
+			if n.err != nil {
+				return nil, n.err
+			}
+			if n.name == "" {
+				return nil, Error("cannot marshal a custom predicate to JSON, register it with RegisterPredicate and use Fn instead")
+			}
+			args := n.args
+			if args == nil {
+				args = []interface{}{}
+			}
+			evals[i] = map[string]interface{}{propFn: n.name, propFnArgs: args}
+		default:
+			return nil, Error(fmt.Sprintf("cannot marshal evaluator of type %T to JSON", e))
+		}
+	}
+	if cs.conj == logicalOr {
+		return map[string]interface{}{logicalOr.String(): evals}, nil
+	}
+	return evals, nil
+}
+
+func marshalOperand(operand interface{}) interface{} {
+	switch o := operand.(type) {
+	case Param:
+		return map[string]interface{}{propParam: string(o)}
+	case literal:
+		return o.escaped()
+	case []interface{}:
+		m := make([]interface{}, len(o))
+		for i, v := range o {
+			m[i] = marshalOperand(v)
+		}
+		return m
+	}
+	return operand
+}
+
 func unmarshalConditionSet(path []string, csi interface{}) (ConditionSet, error) {
 	cs := ConditionSet{}
 	cs.evaluators = []Evaluator{}
@@ -127,9 +410,28 @@ func unmarshalNestedConditions(path []string, csinner []interface{}) ([]Evaluato
 	for i, v := range csinner {
 		if jarr, ok := v.([]interface{}); ok && len(jarr) == 3 && isstring(jarr[1]) {
 			// smells like a condition!
-			evals[i] = Cond(jarr[0], jarr[1].(string), jarr[2])
+			cpath := append(path, strconv.Itoa(i))
+			left, err := unmarshalOperand(append(cpath, "0"), jarr[0])
+			if err != nil {
+				return nil, err
+			}
+			right, err := unmarshalOperand(append(cpath, "2"), jarr[2])
+			if err != nil {
+				return nil, err
+			}
+			evals[i] = Cond(left, jarr[1].(string), right)
 			continue
 		}
+		if jobj, ok := v.(map[string]interface{}); ok {
+			if _, ok := jobj[propFn]; ok {
+				var err error
+				evals[i], err = unmarshalPredicate(append(path, strconv.Itoa(i)), jobj)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
 		var err error
 		evals[i], err = unmarshalConditionSet(append(path, strconv.Itoa(i)), v)
 		if err != nil {
@@ -139,6 +441,61 @@ func unmarshalNestedConditions(path []string, csinner []interface{}) ([]Evaluato
 	return evals, nil
 }
 
+// unmarshalOperand converts {"$param": "name"} placeholders in a condition
+// operand, or in the elements of an array operand, to a Param.
+func unmarshalOperand(path []string, v interface{}) (interface{}, error) {
+	switch o := v.(type) {
+	case map[string]interface{}:
+		pi, ok := o[propParam]
+		if !ok || len(o) != 1 {
+			return v, nil
+		}
+		name, ok := pi.(string)
+		if !ok || name == "" {
+			return nil, jsonInvalidType(append(path, propParam), pi, jtypeString)
+		}
+		return Param(name), nil
+	case []interface{}:
+		for i, e := range o {
+			ev, err := unmarshalOperand(append(path, strconv.Itoa(i)), e)
+			if err != nil {
+				return nil, err
+			}
+			o[i] = ev
+		}
+	}
+	return v, nil
+}
+
+func unmarshalPredicate(path []string, o map[string]interface{}) (Evaluator, error) {
+	for k := range o {
+		if k != propFn && k != propFnArgs {
+			return nil, Error(fmt.Sprintf(
+				`invalid value for property "%s": unexpected key "%s" in predicate, expected only "%s" and "%s"`,
+				strings.Join(path, "."), k, propFn, propFnArgs,
+			))
+		}
+	}
+	name, ok := o[propFn].(string)
+	if !ok {
+		return nil, jsonInvalidType(append(path, propFn), o[propFn], jtypeString)
+	}
+	args := []interface{}{}
+	if ai, ok := o[propFnArgs]; ok {
+		if args, ok = ai.([]interface{}); !ok {
+			return nil, jsonInvalidType(append(path, propFnArgs), ai, jtypeArray)
+		}
+	}
+	if _, ok := lookupPredicate(name); !ok {
+		return nil, jsonInvalidPropValue(append(path, propFn), "registered predicate name", fmt.Sprintf(`"%s"`, name))
+	}
+	p, err := newPredicate(name, args)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
 func isstring(v interface{}) bool {
 	_, ok := v.(string)
 	return ok
@@ -181,7 +538,7 @@ func unmarshalSlugSet(ss *SlugSet, prop string, w map[string]interface{}) error
 			return err
 		}
 		path = append(path, "$not")
-		ss.mode = blocklist
+		ss.mode = Blocklist
 		switch ssn := ssni.(type) {
 		case []interface{}:
 			// empty slug set IS allowed if the slugset is a blocklist.
@@ -206,7 +563,7 @@ func unmarshalSlugSet(ss *SlugSet, prop string, w map[string]interface{}) error
 		}
 	case string:
 		if _ss == "*" {
-			ss.mode = wildcard
+			ss.mode = Wildcard
 			ss.elements = []string{}
 		} else {
 			ss.elements = []string{_ss}
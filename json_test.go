@@ -3,6 +3,7 @@ package authr
 import (
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -129,6 +130,156 @@ func unmarshalScenarios() []unmarshalScenario {
 			d:   `{"access":"deny","where":{"action":"delete","rsrc_type":[],"rsrc_match":[["@id","&",[1,2,3]]]}}`,
 			err: `invalid value for property "where.rsrc_type", expecting non-empty array, got empty array`,
 		},
+		{
+			n:   `should err; invalid "priority" prop type`,
+			d:   `{"access":"deny","priority":"high","where":{"action":"delete","rsrc_type":"zone","rsrc_match":[]}}`,
+			err: `expecting JSON number for property "priority", got JSON string`,
+		},
+		{
+			n:   `should err; non-integer "priority" prop`,
+			d:   `{"access":"deny","priority":1.5,"where":{"action":"delete","rsrc_type":"zone","rsrc_match":[]}}`,
+			err: `invalid value for property "priority", expecting integer, got 1.5`,
+		},
+		{
+			n: "ok case with priority",
+			d: `{"access":"deny","priority":-20,"where":{"action":"delete","rsrc_type":"zone","rsrc_match":[["@id","=",1]]}}`,
+			r: new(Rule).
+				Access(Deny).
+				Priority(-20).
+				Where(
+					Action("delete"),
+					ResourceType("zone"),
+					ResourceMatch(Cond("@id", "=", float64(1))),
+				),
+		},
+		{
+			n:   `should err; invalid "not_before" prop type`,
+			d:   `{"access":"allow","not_before":1577836800,"where":{"action":"delete","rsrc_type":"zone","rsrc_match":[]}}`,
+			err: `expecting JSON string for property "not_before", got JSON number`,
+		},
+		{
+			n:   `should err; invalid "not_after" prop`,
+			d:   `{"access":"allow","not_after":"tomorrow","where":{"action":"delete","rsrc_type":"zone","rsrc_match":[]}}`,
+			err: `invalid value for property "not_after", expecting RFC 3339 time, got "tomorrow"`,
+		},
+		{
+			n:   `should err; "not_after" before "not_before"`,
+			d:   `{"access":"allow","not_before":"2020-01-02T00:00:00Z","not_after":"2020-01-01T00:00:00Z","where":{"action":"delete","rsrc_type":"zone","rsrc_match":[]}}`,
+			err: `invalid value for property "not_after", expecting time after "not_before", got "2020-01-01T00:00:00Z"`,
+		},
+		{
+			n: "ok case with validity window",
+			d: `{"access":"allow","not_before":"2020-01-01T00:00:00Z","not_after":"2020-01-01T12:30:00.5Z","where":{"action":"delete","rsrc_type":"zone","rsrc_match":[["@id","=",1]]}}`,
+			r: new(Rule).
+				Access(Allow).
+				NotBefore(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)).
+				NotAfter(time.Date(2020, 1, 1, 12, 30, 0, 5e8, time.UTC)).
+				Where(
+					Action("delete"),
+					ResourceType("zone"),
+					ResourceMatch(Cond("@id", "=", float64(1))),
+				),
+		},
+		{
+			n:   `should err; invalid "obligations" prop type`,
+			d:   `{"access":"allow","obligations":{"id":"require_mfa"},"where":{"action":"delete","rsrc_type":"zone","rsrc_match":[]}}`,
+			err: `expecting JSON array for property "obligations", got JSON object`,
+		},
+		{
+			n:   `should err; missing obligation id`,
+			d:   `{"access":"allow","obligations":[{"params":{}}],"where":{"action":"delete","rsrc_type":"zone","rsrc_match":[]}}`,
+			err: `invalid rule; missing required property "obligations.0.id"`,
+		},
+		{
+			n:   `should err; empty obligation id`,
+			d:   `{"access":"allow","obligations":[{"id":"audit"},{"id":""}],"where":{"action":"delete","rsrc_type":"zone","rsrc_match":[]}}`,
+			err: `invalid value for property "obligations.1.id", expecting non-empty string, got empty string`,
+		},
+		{
+			n:   `should err; invalid obligation params`,
+			d:   `{"access":"allow","obligations":[{"id":"audit","params":["high"]}],"where":{"action":"delete","rsrc_type":"zone","rsrc_match":[]}}`,
+			err: `expecting JSON object for property "obligations.0.params", got JSON array`,
+		},
+		{
+			n:   `should err; unexpected obligation key`,
+			d:   `{"access":"allow","obligations":[{"id":"audit","level":"high"}],"where":{"action":"delete","rsrc_type":"zone","rsrc_match":[]}}`,
+			err: `invalid value for property "obligations.0": unexpected key "level" in obligation, expected only "id" and "params"`,
+		},
+		{
+			n: "ok case with obligations",
+			d: `{"access":"allow","obligations":[{"id":"require_mfa"},{"id":"audit","params":{"level":"high"}}],"where":{"action":"delete","rsrc_type":"zone","rsrc_match":[["@id","=",1]]}}`,
+			r: new(Rule).
+				Access(Allow).
+				Obligations(
+					Obligation{ID: "require_mfa"},
+					Obligation{ID: "audit", Params: map[string]interface{}{"level": "high"}},
+				).
+				Where(
+					Action("delete"),
+					ResourceType("zone"),
+					ResourceMatch(Cond("@id", "=", float64(1))),
+				),
+		},
+		{
+			n:   `should err; invalid "reason" prop type`,
+			d:   `{"access":"deny","reason":"locked","where":{"action":"delete","rsrc_type":"zone","rsrc_match":[]}}`,
+			err: `expecting JSON object for property "reason", got JSON string`,
+		},
+		{
+			n:   `should err; invalid "reason.code" prop type`,
+			d:   `{"access":"deny","reason":{"code":423},"where":{"action":"delete","rsrc_type":"zone","rsrc_match":[]}}`,
+			err: `expecting JSON string for property "reason.code", got JSON number`,
+		},
+		{
+			n:   `should err; empty "reason" prop`,
+			d:   `{"access":"deny","reason":{},"where":{"action":"delete","rsrc_type":"zone","rsrc_match":[]}}`,
+			err: `invalid value for property "reason", expecting non-empty "code" or "message", got neither`,
+		},
+		{
+			n:   `should err; unexpected "reason" key`,
+			d:   `{"access":"deny","reason":{"code":"zone_locked","status":403},"where":{"action":"delete","rsrc_type":"zone","rsrc_match":[]}}`,
+			err: `invalid value for property "reason": unexpected key "status" in reason, expected only "code" and "message"`,
+		},
+		{
+			n: "ok case with reason",
+			d: `{"access":"deny","reason":{"code":"zone_locked","message":"this zone is locked by your organization"},"where":{"action":"delete","rsrc_type":"zone","rsrc_match":[["@id","=",1]]}}`,
+			r: new(Rule).
+				Access(Deny).
+				Reason("zone_locked", "this zone is locked by your organization").
+				Where(
+					Action("delete"),
+					ResourceType("zone"),
+					ResourceMatch(Cond("@id", "=", float64(1))),
+				),
+		},
+		{
+			n:   `should err; invalid "id" prop type`,
+			d:   `{"id":7,"access":"deny","where":{"action":"delete","rsrc_type":"zone","rsrc_match":[]}}`,
+			err: `expecting JSON string for property "id", got JSON number`,
+		},
+		{
+			n:   `should err; empty "id" prop`,
+			d:   `{"id":"","access":"deny","where":{"action":"delete","rsrc_type":"zone","rsrc_match":[]}}`,
+			err: `invalid value for property "id", expecting non-empty string, got empty string`,
+		},
+		{
+			n:   `should err; negative "version" prop`,
+			d:   `{"id":"no-locked-deletes","version":-1,"access":"deny","where":{"action":"delete","rsrc_type":"zone","rsrc_match":[]}}`,
+			err: `invalid value for property "version", expecting non-negative integer, got -1`,
+		},
+		{
+			n: "ok case with id and version",
+			d: `{"id":"no-locked-deletes","version":3,"access":"deny","where":{"action":"delete","rsrc_type":"zone","rsrc_match":[["@locked","=",true]]}}`,
+			r: new(Rule).
+				ID("no-locked-deletes").
+				Version(3).
+				Access(Deny).
+				Where(
+					Action("delete"),
+					ResourceType("zone"),
+					ResourceMatch(Cond("@locked", "=", true)),
+				),
+		},
 		{
 			n: "ok case 1",
 			d: `{"access":"deny","where":{"action":"delete","rsrc_type":"zone","rsrc_match":[["@id","&",[1,2,3]]]}}`,
@@ -188,3 +339,68 @@ func TestRuleUnmarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestRuleMarshalJSON(t *testing.T) {
+	for _, s := range unmarshalScenarios() {
+		if s.r == nil {
+			continue
+		}
+		t.Run("should round-trip "+s.n, func(t *testing.T) {
+			data, err := json.Marshal(s.r)
+			require.Nil(t, err)
+			r := new(Rule)
+			require.Nil(t, json.Unmarshal(data, r))
+			require.Equal(t, s.r, r)
+		})
+	}
+	t.Run("should round-trip blocklists, wildcards, placeholders, predicates and $meta", func(t *testing.T) {
+		rule := new(Rule).
+			Access(Deny).
+			Meta(map[string]interface{}{"ticket": "SEC-1"}).
+			Where(
+				Not(Action()),
+				ResourceType("*"),
+				ResourceMatch(
+					Or(
+						Cond("@owner", "=", Param("user_id")),
+						Cond("@tags", "&", []interface{}{"a", Param("tag")}),
+					),
+					Fn("test_owned_by", "user"),
+				),
+			)
+		data, err := json.Marshal(rule)
+		require.Nil(t, err)
+		require.JSONEq(t, `{
+			"access": "deny",
+			"where": {
+				"rsrc_type": "*",
+				"rsrc_match": [
+					{"$or": [
+						["@owner", "=", {"$param": "user_id"}],
+						["@tags", "&", ["a", {"$param": "tag"}]]
+					]},
+					{"$fn": "test_owned_by", "args": ["user"]}
+				],
+				"action": {"$not": []}
+			},
+			"$meta": {"ticket": "SEC-1"}
+		}`, string(data))
+		r := new(Rule)
+		require.Nil(t, json.Unmarshal(data, r))
+		require.Equal(t, rule.where.resourceMatch.evaluators[0], r.where.resourceMatch.evaluators[0])
+		again, err := json.Marshal(r)
+		require.Nil(t, err)
+		require.JSONEq(t, string(data), string(again))
+	})
+	t.Run("should err on custom predicates", func(t *testing.T) {
+		rule := new(Rule).Access(Allow).Where(
+			Action("read"),
+			ResourceType("zone"),
+			ResourceMatch(Custom(PredicateFunc(func(Resource, Environment) (bool, error) {
+				return true, nil
+			}))),
+		)
+		_, err := json.Marshal(rule)
+		require.NotNil(t, err)
+	})
+}
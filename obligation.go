@@ -0,0 +1,59 @@
+package authr
+
+import "fmt"
+
+// Obligation is an instruction attached to a rule that must be carried out
+// for the decision of that rule to stand, like "allow, but require MFA" or
+// "allow, but log to the audit trail". In JSON, obligations are listed on the
+// rule:
+//
+//	"obligations": [{"id": "require_mfa"}, {"id": "audit", "params": {"level": "high"}}]
+type Obligation struct {
+	ID     string
+	Params map[string]interface{}
+}
+
+// ObligationHandler carries out an obligation for a decision about the
+// resource. Values from the Environment passed to CanWithEnv are available
+// through env, which is never nil. Returning an error denies the attempt.
+type ObligationHandler func(o Obligation, r Resource, env Environment) error
+
+// WithObligationHandler registers the handler for obligations with the given
+// ID. It will panic if the ID is empty, the handler is nil or a handler is
+// already registered for the ID.
+func WithObligationHandler(id string, h ObligationHandler) Option {
+	return func(a *Authorizer) {
+		if id == "" {
+			panic("authr: WithObligationHandler called with an empty ID")
+		}
+		if h == nil {
+			panic(fmt.Sprintf("authr: WithObligationHandler called with a nil handler for '%s'", id))
+		}
+		if a.handlers == nil {
+			a.handlers = make(map[string]ObligationHandler)
+		}
+		if _, ok := a.handlers[id]; ok {
+			panic(fmt.Sprintf("authr: obligation handler for '%s' is already registered", id))
+		}
+		a.handlers[id] = h
+	}
+}
+
+// fulfill runs the handlers of the decision's obligations, failing closed: an
+// obligation without a handler is an error.
+func (a *Authorizer) fulfill(d Decision, r Resource) error {
+	if len(d.Obligations) == 0 {
+		return nil
+	}
+	r, env := splitEnv(r)
+	for _, o := range d.Obligations {
+		h, ok := a.handlers[o.ID]
+		if !ok {
+			return Error(fmt.Sprintf("unknown obligation: '%s'", o.ID))
+		}
+		if err := h(o, r, env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package authr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestObligations(t *testing.T) {
+	mfa := Obligation{ID: "require_mfa"}
+	audit := Obligation{ID: "audit", Params: map[string]interface{}{"level": "high"}}
+	allowWithMFA := new(Rule).Access(Allow).Obligations(mfa, audit).Where(Action("delete"), ResourceType("zone"), ResourceMatch())
+	allowRead := new(Rule).Access(Allow).Obligations(audit).Where(Action("read"), ResourceType("zone"), ResourceMatch())
+	zone := testResource{rtype: "zone"}
+
+	var audited []Obligation
+	a := NewAuthorizer(
+		WithObligationHandler("require_mfa", func(o Obligation, r Resource, env Environment) error {
+			require.Equal(t, zone, r)
+			if v, err := env.GetEnvironmentValue("mfa"); err != nil || v != true {
+				return Error("MFA required")
+			}
+			return nil
+		}),
+		WithObligationHandler("audit", func(o Obligation, r Resource, env Environment) error {
+			audited = append(audited, o)
+			return nil
+		}),
+	)
+
+	t.Run("should return obligations alongside the decision", func(t *testing.T) {
+		d, err := a.Decide(RuleList{allowWithMFA}, "delete", zone)
+		require.Nil(t, err)
+		require.True(t, d.Allowed)
+		require.Equal(t, []Obligation{mfa, audit}, d.Obligations)
+	})
+	t.Run("should carry out obligations in Can", func(t *testing.T) {
+		audited = nil
+		ok, err := a.CanWithEnv(RuleList{allowWithMFA}, "delete", zone, Env{"mfa": true})
+		require.Nil(t, err)
+		require.True(t, ok)
+		require.Equal(t, []Obligation{audit}, audited)
+	})
+	t.Run("should deny if a handler fails", func(t *testing.T) {
+		ok, err := a.CanWithEnv(RuleList{allowWithMFA}, "delete", zone, Env{"mfa": false})
+		require.Equal(t, Error("MFA required"), err)
+		require.False(t, ok)
+		ok, err = a.Can(RuleList{allowWithMFA}, "delete", zone)
+		require.Equal(t, Error("MFA required"), err)
+		require.False(t, ok)
+	})
+	t.Run("should fail closed on unknown obligations", func(t *testing.T) {
+		ok, err := NewAuthorizer().Can(RuleList{allowWithMFA}, "delete", zone)
+		require.Equal(t, Error("unknown obligation: 'require_mfa'"), err)
+		require.False(t, ok)
+		ok, err = Can(RuleList{allowRead}, "read", zone)
+		require.Equal(t, Error("unknown obligation: 'audit'"), err)
+		require.False(t, ok)
+	})
+	t.Run("should collect the obligations of every member of an intersection", func(t *testing.T) {
+		d, err := a.Decide(Bounded(RuleList{allowWithMFA}, RuleList{allowRead, new(Rule).Access(Allow).Obligations(audit).Where(Action("*"), ResourceType("zone"), ResourceMatch())}), "delete", zone)
+		require.Nil(t, err)
+		require.True(t, d.Allowed)
+		require.Equal(t, []Obligation{mfa, audit, audit}, d.Obligations)
+	})
+	t.Run("should not carry out obligations of rules that did not decide", func(t *testing.T) {
+		audited = nil
+		ok, err := a.Can(RuleList{allowRead}, "delete", zone)
+		require.Nil(t, err)
+		require.False(t, ok)
+		require.Nil(t, audited)
+	})
+	t.Run("should panic on invalid handlers", func(t *testing.T) {
+		noop := func(Obligation, Resource, Environment) error { return nil }
+		require.Panics(t, func() { NewAuthorizer(WithObligationHandler("", noop)) })
+		require.Panics(t, func() { NewAuthorizer(WithObligationHandler("audit", nil)) })
+		require.Panics(t, func() {
+			NewAuthorizer(WithObligationHandler("audit", noop), WithObligationHandler("audit", noop))
+		})
+	})
+}
@@ -0,0 +1,127 @@
+package authr
+
+import "time"
+
+// DecisionEvent describes an authorization attempt and its outcome, for a
+// DecisionObserver.
+type DecisionEvent struct {
+	// Time is when the attempt was made, according to the Authorizer's clock.
+	Time time.Time
+
+	// SubjectKey identifies the subject if it is a KeyedSubject, and is empty
+	// otherwise.
+	SubjectKey string
+
+	Action string
+
+	// ResourceType is empty if the type of the resource was not retrieved,
+	// because it could not be or because the attempt failed before it was
+	// needed.
+	ResourceType string
+
+	// Attributes holds the values of the attributes the observer was
+	// registered with, as far as they could be retrieved.
+	Attributes map[string]interface{}
+
+	// Decision and Err are the outcome of the attempt. With Can, an attempt
+	// is only allowed if Decision.Allowed is true and Err is nil, since its
+	// obligations may fail.
+	Decision Decision
+	Err      error
+
+	// Cached reports whether the Decision came from a DecisionCache.
+	Cached bool
+
+	// Latency is how long it took to reach the outcome.
+	Latency time.Duration
+}
+
+// DecisionObserver is notified of every attempt answered by an Authorizer, or
+// a DecisionCache in front of it, for example to keep an audit trail. Since
+// ObserveDecision is called before the answer is returned, and possibly from
+// many goroutines at once, it should be fast and safe for concurrent use.
+type DecisionObserver interface {
+	ObserveDecision(e DecisionEvent)
+}
+
+// DecisionSampler can be implemented by a DecisionObserver that only records
+// some of the events, like a fraction of them. SampleDecision is called with
+// every event before the observer's attributes are retrieved, and
+// ObserveDecision is only called with the events it samples, so that the
+// attributes are not retrieved for nothing.
+type DecisionSampler interface {
+	SampleDecision(e DecisionEvent) bool
+}
+
+// DecisionObserverFunc is a function that implements DecisionObserver.
+type DecisionObserverFunc func(e DecisionEvent)
+
+// ObserveDecision calls f(e).
+func (f DecisionObserverFunc) ObserveDecision(e DecisionEvent) {
+	f(e)
+}
+
+type observer struct {
+	o          DecisionObserver
+	attributes []string
+}
+
+// WithDecisionObserver registers an observer notified of every attempt, or of
+// the attempts it samples if it is a DecisionSampler, along with the values of
+// the provided resource attributes. It will panic if the observer is nil.
+func WithDecisionObserver(o DecisionObserver, attributes ...string) Option {
+	return func(a *Authorizer) {
+		if o == nil {
+			panic("authr: WithDecisionObserver called with a nil observer")
+		}
+		a.observers = append(a.observers, observer{o: o, attributes: attributes})
+	}
+}
+
+func (a *Authorizer) observe(s Subject, at *attempt, d Decision, err error, cached bool, start time.Time) {
+	if len(a.observers) == 0 {
+		return
+	}
+	e := DecisionEvent{
+		Time:     at.now,
+		Action:   at.action,
+		Decision: d,
+		Err:      err,
+		Cached:   cached,
+		Latency:  time.Since(start),
+	}
+	if ks, ok := originalSubject(s).(KeyedSubject); ok {
+		e.SubjectKey = ks.SubjectKey()
+	}
+	if at.rtype != nil {
+		e.ResourceType = *at.rtype
+	}
+	r, _ := splitEnv(at.r)
+	// attributes are only retrieved once, however many observers want them
+	type attribute struct {
+		v  interface{}
+		ok bool
+	}
+	retrieved := make(map[string]attribute)
+	for _, o := range a.observers {
+		e.Attributes = nil
+		if ds, ok := o.o.(DecisionSampler); ok && !ds.SampleDecision(e) {
+			continue
+		}
+		if len(o.attributes) > 0 {
+			e.Attributes = make(map[string]interface{}, len(o.attributes))
+			for _, k := range o.attributes {
+				attr, ok := retrieved[k]
+				if !ok {
+					v, err := r.GetResourceAttribute(k)
+					attr = attribute{v: v, ok: err == nil}
+					retrieved[k] = attr
+				}
+				if attr.ok {
+					e.Attributes[k] = attr.v
+				}
+			}
+		}
+		o.o.ObserveDecision(e)
+	}
+}
@@ -0,0 +1,162 @@
+package authr
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recordingObserver struct {
+	mu     sync.Mutex
+	events []DecisionEvent
+}
+
+func (o *recordingObserver) ObserveDecision(e DecisionEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	e.Latency = 0
+	o.events = append(o.events, e)
+}
+
+type samplingObserver struct {
+	recordingObserver
+	sample  bool
+	sampled int
+}
+
+func (o *samplingObserver) SampleDecision(DecisionEvent) bool {
+	o.sampled++
+	return o.sample
+}
+
+type countingResource struct {
+	testResource
+	retrieved map[string]int
+}
+
+func (r *countingResource) GetResourceAttribute(key string) (interface{}, error) {
+	if r.retrieved == nil {
+		r.retrieved = make(map[string]int)
+	}
+	r.retrieved[key]++
+	return r.testResource.GetResourceAttribute(key)
+}
+
+func TestDecisionObserver(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	deny := new(Rule).ID("no-locked-deletes").Access(Deny).Where(Action("delete"), ResourceType("zone"), ResourceMatch(Cond("@locked", "=", true)))
+	allow := new(Rule).Access(Allow).Where(Action("*"), ResourceType("zone"), ResourceMatch())
+	s := &keyedSubject{key: "user:1", rules: []*Rule{deny, allow}}
+	zone := versionedResource{
+		testResource: testResource{rtype: "zone", attributes: map[string]interface{}{"id": "z1", "locked": true, "secret": "s3cr3t"}},
+		version:      "z1@1",
+	}
+	newAuthorizer := func(o DecisionObserver, attributes ...string) *Authorizer {
+		return NewAuthorizer(
+			WithClock(func() time.Time { return now }),
+			WithDecisionObserver(o, attributes...),
+		)
+	}
+
+	t.Run("should observe every attempt", func(t *testing.T) {
+		o := &recordingObserver{}
+		a := newAuthorizer(o, "id", "missing")
+		ok, err := a.Can(s, "delete", zone)
+		require.Nil(t, err)
+		require.False(t, ok)
+		_, err = a.Decide(RuleList{allow}, "read", zone)
+		require.Nil(t, err)
+		_, err = a.CanWithEnv(s, "read", testResource{rterr: Error("no type"), raerr: Error("no attributes")}, Env{})
+		require.Equal(t, Error("no type"), err)
+		require.Equal(t, []DecisionEvent{
+			{
+				Time:         now,
+				SubjectKey:   "user:1",
+				Action:       "delete",
+				ResourceType: "zone",
+				Attributes:   map[string]interface{}{"id": "z1", "missing": nil},
+				Decision:     Decision{Rule: deny, RuleIndex: 0, RuleID: "no-locked-deletes"},
+			},
+			{
+				Time:         now,
+				Action:       "read",
+				ResourceType: "zone",
+				Attributes:   map[string]interface{}{"id": "z1", "missing": nil},
+				Decision:     Decision{Allowed: true, Rule: allow, RuleIndex: 0},
+			},
+			{
+				Time:       now,
+				SubjectKey: "user:1",
+				Action:     "read",
+				Attributes: map[string]interface{}{},
+				Decision:   Decision{RuleIndex: -1},
+				Err:        Error("no type"),
+			},
+		}, o.events)
+	})
+	t.Run("should observe failed obligations", func(t *testing.T) {
+		o := &recordingObserver{}
+		a := NewAuthorizer(
+			WithDecisionObserver(o),
+			WithObligationHandler("mfa", func(Obligation, Resource, Environment) error { return Error("mfa required") }),
+		)
+		_, err := a.Can(RuleList{new(Rule).Access(Allow).Obligations(Obligation{ID: "mfa"}).Where(Action("read"), ResourceType("zone"), ResourceMatch())}, "read", zone)
+		require.Equal(t, Error("mfa required"), err)
+		require.Len(t, o.events, 1)
+		require.True(t, o.events[0].Decision.Allowed)
+		require.Equal(t, Error("mfa required"), o.events[0].Err)
+	})
+	t.Run("should notify every observer with its attributes", func(t *testing.T) {
+		o1, o2 := &recordingObserver{}, &recordingObserver{}
+		a := NewAuthorizer(WithDecisionObserver(o1), WithDecisionObserver(o2, "secret"))
+		_, err := a.Can(s, "read", zone)
+		require.Nil(t, err)
+		require.Nil(t, o1.events[0].Attributes)
+		require.Equal(t, map[string]interface{}{"secret": "s3cr3t"}, o2.events[0].Attributes)
+	})
+	t.Run("should only retrieve attributes for sampled events, and only once", func(t *testing.T) {
+		o1, o2 := &samplingObserver{sample: true}, &samplingObserver{}
+		r := &countingResource{testResource: zone.testResource}
+		a := NewAuthorizer(WithDecisionObserver(o1, "id", "locked"), WithDecisionObserver(o1, "id"), WithDecisionObserver(o2, "secret"))
+		_, err := a.Can(s, "delete", r)
+		require.Nil(t, err)
+		require.Len(t, o1.events, 2)
+		require.Equal(t, map[string]interface{}{"id": "z1", "locked": true}, o1.events[0].Attributes)
+		require.Equal(t, map[string]interface{}{"id": "z1"}, o1.events[1].Attributes)
+		require.Empty(t, o2.events)
+		require.Equal(t, 1, o2.sampled)
+		// "locked" is also retrieved once to evaluate the rule
+		require.Equal(t, map[string]int{"id": 1, "locked": 2}, r.retrieved)
+	})
+	t.Run("should observe decisions from a DecisionCache", func(t *testing.T) {
+		o := &recordingObserver{}
+		c := NewDecisionCache(newAuthorizer(o))
+		for i := 0; i < 2; i++ {
+			_, err := c.Can(s, "delete", zone)
+			require.Nil(t, err)
+		}
+		_, err := c.Decide(s, "delete", zone)
+		require.Nil(t, err)
+		require.Len(t, o.events, 3)
+		require.Equal(t, []bool{false, true, true}, []bool{o.events[0].Cached, o.events[1].Cached, o.events[2].Cached})
+		require.Equal(t, "user:1", o.events[2].SubjectKey)
+	})
+	t.Run("should measure latency", func(t *testing.T) {
+		var latency time.Duration
+		slow := PredicateFunc(func(Resource, Environment) (bool, error) {
+			time.Sleep(10 * time.Millisecond)
+			return true, nil
+		})
+		a := NewAuthorizer(WithDecisionObserver(DecisionObserverFunc(func(e DecisionEvent) {
+			latency = e.Latency
+		})))
+		_, err := a.Can(RuleList{new(Rule).Access(Allow).Where(Action("read"), ResourceType("zone"), ResourceMatch(Custom(slow)))}, "read", zone)
+		require.Nil(t, err)
+		require.True(t, latency >= 10*time.Millisecond, "latency was %s", latency)
+	})
+	t.Run("should panic on a nil observer", func(t *testing.T) {
+		require.Panics(t, func() { NewAuthorizer(WithDecisionObserver(nil)) })
+	})
+}
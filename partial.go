@@ -0,0 +1,373 @@
+package authr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Expr is a residual boolean expression over the unknown attributes of a
+// resource, returned from PartialEval. It is one of Constant, Comparison,
+// Conjunction, Disjunction or Negation.
+type Expr interface {
+	fmt.Stringer
+	isExpr()
+}
+
+// Constant is an expression whose value is already known.
+type Constant bool
+
+// Attribute references an unknown attribute of the resource in a Comparison.
+type Attribute string
+
+// Comparison is a condition that references at least one unknown attribute.
+// Each operand is either an Attribute or a value that has already been
+// resolved, with escapes removed and "$env." references replaced.
+type Comparison struct {
+	Left     interface{}
+	Operator string
+	Right    interface{}
+}
+
+// Conjunction is true if all of its expressions are true.
+type Conjunction []Expr
+
+// Disjunction is true if any of its expressions is true.
+type Disjunction []Expr
+
+// Negation is true if its expression is false.
+type Negation struct {
+	Expr Expr
+}
+
+func (Constant) isExpr()    {}
+func (Comparison) isExpr()  {}
+func (Conjunction) isExpr() {}
+func (Disjunction) isExpr() {}
+func (Negation) isExpr()    {}
+
+func (c Constant) String() string {
+	if c {
+		return "true"
+	}
+	return "false"
+}
+
+func (c Comparison) String() string {
+	return fmt.Sprintf("%s %s %s", operandString(c.Left), c.Operator, operandString(c.Right))
+}
+
+func operandString(v interface{}) string {
+	if a, ok := v.(Attribute); ok {
+		return "@" + string(a)
+	}
+	return fmt.Sprintf("%#v", v)
+}
+
+func (c Conjunction) String() string {
+	return joinExprs(c, " AND ")
+}
+
+func (d Disjunction) String() string {
+	return joinExprs(d, " OR ")
+}
+
+func joinExprs(exprs []Expr, sep string) string {
+	s := make([]string, len(exprs))
+	for i, e := range exprs {
+		s[i] = e.String()
+	}
+	return "(" + strings.Join(s, sep) + ")"
+}
+
+func (n Negation) String() string {
+	return "NOT " + n.Expr.String()
+}
+
+// and returns the conjunction of the expressions, folding constants and
+// flattening nested conjunctions.
+func and(exprs ...Expr) Expr {
+	c := Conjunction{}
+	for _, e := range exprs {
+		switch e := e.(type) {
+		case Constant:
+			if !e {
+				return Constant(false)
+			}
+		case Conjunction:
+			c = append(c, e...)
+		default:
+			c = append(c, e)
+		}
+	}
+	switch len(c) {
+	case 0:
+		return Constant(true)
+	case 1:
+		return c[0]
+	}
+	return c
+}
+
+// or returns the disjunction of the expressions, folding constants and
+// flattening nested disjunctions.
+func or(exprs ...Expr) Expr {
+	d := Disjunction{}
+	for _, e := range exprs {
+		switch e := e.(type) {
+		case Constant:
+			if e {
+				return Constant(true)
+			}
+		case Disjunction:
+			d = append(d, e...)
+		default:
+			d = append(d, e)
+		}
+	}
+	switch len(d) {
+	case 0:
+		return Constant(false)
+	case 1:
+		return d[0]
+	}
+	return d
+}
+
+func not(e Expr) Expr {
+	switch e := e.(type) {
+	case Constant:
+		return !e
+	case Negation:
+		return e.Expr
+	}
+	return Negation{Expr: e}
+}
+
+// knownResource is a resource of which only some attributes are known.
+type knownResource struct {
+	typ   string
+	known map[string]interface{}
+}
+
+func (k knownResource) GetResourceType() (string, error) {
+	return k.typ, nil
+}
+
+func (k knownResource) GetResourceAttribute(key string) (interface{}, error) {
+	return k.known[key], nil
+}
+
+// PartialEval answers the question "Can this subject perform this action on
+// resources of this type?" without a resource, see the package-level
+// PartialEval.
+func (a *Authorizer) PartialEval(s Subject, action, resourceType string, known map[string]interface{}) (Expr, error) {
+	return a.partialEval(s, action, knownResource{typ: resourceType, known: known})
+}
+
+// PartialEvalWithEnv is just like PartialEval, except conditions may also
+// reference values in the provided Environment using the "$env." prefix.
+func (a *Authorizer) PartialEvalWithEnv(s Subject, action, resourceType string, known map[string]interface{}, env Environment) (Expr, error) {
+	return a.partialEval(s, action, envResource{Resource: knownResource{typ: resourceType, known: known}, env: env})
+}
+
+func (a *Authorizer) partialEval(s Subject, action string, r Resource) (Expr, error) {
+	at := &attempt{action: action, r: r, now: a.now()}
+	if a.layers == nil {
+		allow, _, err := a.partialSubject(s, at)
+		return allow, err
+	}
+	// like the rules of a list under FirstApplicable, the first layer with an
+	// opinion decides
+	var (
+		allows    []Expr
+		undecided Expr = Constant(true)
+	)
+	for _, l := range a.layers {
+		var (
+			allow, opinion Expr
+			err            error
+		)
+		if l.Rules == nil {
+			allow, opinion, err = a.partialSubject(s, at)
+		} else {
+			var rules []*Rule
+			if rules, err = l.Rules(s); err == nil {
+				allow, opinion, err = a.partialRules(rules, at)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		allows = append(allows, and(undecided, allow))
+		if l.Terminal {
+			break
+		}
+		undecided = and(undecided, not(opinion))
+	}
+	return or(allows...), nil
+}
+
+// partialSubject returns the residual expressions for the subject allowing the
+// attempt and for the subject having an opinion on it.
+func (a *Authorizer) partialSubject(s Subject, at *attempt) (Expr, Expr, error) {
+	i, ok := asIntersection(s)
+	if !ok {
+		rules, err := s.GetRules()
+		if err != nil {
+			return nil, nil, err
+		}
+		return a.partialRules(rules, at)
+	}
+	allows := make([]Expr, len(i.members))
+	for n, m := range i.members {
+		allow, _, err := a.partialSubject(m.subject, at)
+		if err != nil {
+			return nil, nil, err
+		}
+		allows[n] = allow
+	}
+	return and(allows...), Constant(true), nil
+}
+
+func (a *Authorizer) partialRules(rules []*Rule, at *attempt) (Expr, Expr, error) {
+	in, ok, err := rulesIntersection(rules)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ok {
+		return a.partialSubject(in, at)
+	}
+	resourceType, err := at.resourceType()
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		allows, denies, matches []Expr
+		undenied                Expr = Constant(true)
+	)
+	order := byPriority(rules)
+	for n := range rules {
+		i := n
+		if order != nil {
+			i = order[n]
+		}
+		rule := rules[i]
+		if !rule.validAt(at.now) {
+			continue
+		}
+		match, err := rule.partialMatch(resourceType, at.action, at.r)
+		if err != nil {
+			return nil, nil, err
+		}
+		if c, ok := match.(Constant); ok && !bool(c) {
+			continue
+		}
+		matches = append(matches, match)
+		switch rule.access {
+		case Allow:
+			if a.algorithm == FirstApplicable {
+				match = and(undenied, match)
+			}
+			allows = append(allows, match)
+		case Deny:
+			if a.algorithm == FirstApplicable {
+				undenied = and(undenied, not(match))
+			}
+			denies = append(denies, match)
+		default:
+			// unknown type!
+			panic(fmt.Sprintf("authr: unknown access type: '%s'", rule.access))
+		}
+	}
+	allow := or(allows...)
+	if a.algorithm == DenyOverrides {
+		allow = and(allow, not(or(denies...)))
+	}
+	return allow, or(matches...), nil
+}
+
+// partialMatch returns the residual expression for the rule matching the
+// resource type, action and the known attributes of the resource.
+func (rule *Rule) partialMatch(resourceType, action string, r Resource) (Expr, error) {
+	var (
+		ok  bool
+		err error
+	)
+	if ok, err = rule.where.resourceType.contains(resourceType); err != nil || !ok {
+		return Constant(false), err
+	}
+	if ok, err = rule.where.action.contains(action); err != nil || !ok {
+		return Constant(false), err
+	}
+	return rule.where.resourceMatch.partial(r)
+}
+
+func (c ConditionSet) partial(r Resource) (Expr, error) {
+	if len(c.evaluators) == 0 {
+		// vacuous truth, even for "$or", like evaluate
+		return Constant(true), nil
+	}
+	exprs := make([]Expr, len(c.evaluators))
+	for i, e := range c.evaluators {
+		var err error
+		switch n := e.(type) {
+		case ConditionSet:
+			exprs[i], err = n.partial(r)
+		case condition:
+			exprs[i], err = n.partial(r)
+		case predicate:
+			err = Error(fmt.Sprintf("cannot partially evaluate predicate '%s'", n.name))
+		default:
+			err = Error(fmt.Sprintf("cannot partially evaluate %T", e))
+		}
+		if err != nil {
+			return nil, err
+		}
+		// short-circuit on a decided operand, like evaluate, so that the
+		// remaining ones cannot fail where evaluate would not reach them
+		if e, ok := exprs[i].(Constant); ok && bool(e) == (c.conj == logicalOr) {
+			return e, nil
+		}
+	}
+	if c.conj == logicalOr {
+		return or(exprs...), nil
+	}
+	return and(exprs...), nil
+}
+
+func (c condition) partial(r Resource) (Expr, error) {
+	if _, ok := operators[c.op]; !ok {
+		return nil, Error(fmt.Sprintf("unknown operator: '%s'", c.op))
+	}
+	left, lok, err := partialOperand(r, c.left)
+	if err != nil {
+		return nil, err
+	}
+	right, rok, err := partialOperand(r, c.right)
+	if err != nil {
+		return nil, err
+	}
+	if lok && rok {
+		ok, err := operators[c.op].compute(left, right)
+		return Constant(ok), err
+	}
+	return Comparison{Left: left, Operator: c.op, Right: right}, nil
+}
+
+// partialOperand resolves an operand, returning an Attribute and false if it
+// references an unknown attribute of the resource.
+func partialOperand(r Resource, v interface{}) (interface{}, bool, error) {
+	if str, ok := v.(string); ok && len(str) > 0 && str[0] == '@' {
+		known := r
+		if er, ok := r.(envResource); ok {
+			known = er.Resource
+		}
+		if k, ok := known.(knownResource); ok {
+			if _, ok := k.known[str[1:]]; !ok {
+				return Attribute(str[1:]), false, nil
+			}
+		}
+	}
+	resolved, err := determineValue(r, v)
+	return resolved, true, err
+}
@@ -0,0 +1,207 @@
+package authr
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// evalExpr evaluates a residual expression against a resource, as a database
+// would evaluate its translation.
+func evalExpr(e Expr, r Resource) (bool, error) {
+	switch e := e.(type) {
+	case Constant:
+		return bool(e), nil
+	case Comparison:
+		operand := func(v interface{}) (interface{}, error) {
+			if a, ok := v.(Attribute); ok {
+				return r.GetResourceAttribute(string(a))
+			}
+			return v, nil
+		}
+		left, err := operand(e.Left)
+		if err != nil {
+			return false, err
+		}
+		right, err := operand(e.Right)
+		if err != nil {
+			return false, err
+		}
+		return operators[e.Operator].compute(left, right)
+	case Conjunction:
+		for _, x := range e {
+			if ok, err := evalExpr(x, r); err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case Disjunction:
+		for _, x := range e {
+			if ok, err := evalExpr(x, r); err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	case Negation:
+		ok, err := evalExpr(e.Expr, r)
+		return !ok, err
+	}
+	panic(fmt.Sprintf("unexpected expression: %T", e))
+}
+
+func TestPartialEval(t *testing.T) {
+	rule := func(access Access, action string, cs ...Evaluator) *Rule {
+		return new(Rule).Access(access).Where(Action(action), ResourceType("post"), ResourceMatch(cs...))
+	}
+	lockedDeny := rule(Deny, "edit", Cond("@locked", "=", true))
+	ownAllow := rule(Allow, "edit", Cond("@author_id", "=", 1))
+	publicAllow := rule(Allow, "edit", Cond("@public", "=", true))
+
+	t.Run("should produce first-applicable residuals", func(t *testing.T) {
+		e, err := PartialEval(RuleList{lockedDeny, ownAllow, publicAllow}, "edit", "post", nil)
+		require.Nil(t, err)
+		require.Equal(t, Disjunction{
+			Conjunction{
+				Negation{Comparison{Attribute("locked"), "=", true}},
+				Comparison{Attribute("author_id"), "=", 1},
+			},
+			Conjunction{
+				Negation{Comparison{Attribute("locked"), "=", true}},
+				Comparison{Attribute("public"), "=", true},
+			},
+		}, e)
+		require.Equal(t, "((NOT @locked = true AND @author_id = 1) OR (NOT @locked = true AND @public = true))", e.String())
+	})
+	t.Run("should produce deny-overrides residuals", func(t *testing.T) {
+		e, err := NewAuthorizer(WithCombiningAlgorithm(DenyOverrides)).PartialEval(RuleList{ownAllow, lockedDeny}, "edit", "post", nil)
+		require.Nil(t, err)
+		require.Equal(t, "(@author_id = 1 AND NOT @locked = true)", e.String())
+	})
+	t.Run("should produce permit-overrides residuals", func(t *testing.T) {
+		e, err := NewAuthorizer(WithCombiningAlgorithm(PermitOverrides)).PartialEval(RuleList{lockedDeny, ownAllow, publicAllow}, "edit", "post", nil)
+		require.Nil(t, err)
+		require.Equal(t, "(@author_id = 1 OR @public = true)", e.String())
+	})
+	t.Run("should discard rules for other actions and resource types", func(t *testing.T) {
+		e, err := PartialEval(RuleList{lockedDeny, rule(Allow, "read"), ownAllow}, "read", "post", nil)
+		require.Nil(t, err)
+		require.Equal(t, Constant(true), e)
+		e, err = PartialEval(RuleList{ownAllow}, "edit", "comment", nil)
+		require.Nil(t, err)
+		require.Equal(t, Constant(false), e)
+	})
+	t.Run("should evaluate known attributes", func(t *testing.T) {
+		e, err := PartialEval(RuleList{lockedDeny, ownAllow, publicAllow}, "edit", "post", map[string]interface{}{"locked": false})
+		require.Nil(t, err)
+		require.Equal(t, "(@author_id = 1 OR @public = true)", e.String())
+		e, err = PartialEval(RuleList{lockedDeny, ownAllow, publicAllow}, "edit", "post", map[string]interface{}{"locked": true})
+		require.Nil(t, err)
+		require.Equal(t, Constant(false), e)
+	})
+	t.Run("should resolve environment values and escapes", func(t *testing.T) {
+		s := RuleList{rule(Allow, "edit", Cond("@author_id", "=", "$env.user_id"), Cond("@handle", "=", `\@nick`))}
+		e, err := PartialEvalWithEnv(s, "edit", "post", nil, Env{"user_id": 42})
+		require.Nil(t, err)
+		require.Equal(t, Conjunction{
+			Comparison{Attribute("author_id"), "=", 42},
+			Comparison{Attribute("handle"), "=", "@nick"},
+		}, e)
+	})
+	t.Run("should treat empty condition sets as true", func(t *testing.T) {
+		e, err := PartialEval(RuleList{rule(Deny, "edit", Or()), ownAllow}, "edit", "post", nil)
+		require.Nil(t, err)
+		require.Equal(t, Constant(false), e)
+	})
+	t.Run("should short-circuit like Can", func(t *testing.T) {
+		known := map[string]interface{}{"locked": true}
+		s := RuleList{
+			rule(Allow, "edit", Cond("@locked", "=", false), Fn("test_owned_by", "user")),
+			rule(Allow, "edit", Or(Cond("@locked", "=", true), Cond("@id", "<>", 1))),
+		}
+		e, err := PartialEval(s, "edit", "post", known)
+		require.Nil(t, err)
+		require.Equal(t, Constant(true), e)
+		ok, err := Can(s, "edit", testResource{rtype: "post", attributes: known})
+		require.Nil(t, err)
+		require.True(t, ok)
+	})
+	t.Run("should err on predicates", func(t *testing.T) {
+		_, err := PartialEval(RuleList{rule(Allow, "edit", Fn("test_owned_by", "user"))}, "edit", "post", nil)
+		require.Equal(t, Error("cannot partially evaluate predicate 'test_owned_by'"), err)
+	})
+	t.Run("should err on unknown operators", func(t *testing.T) {
+		_, err := PartialEval(RuleList{rule(Allow, "edit", Cond("@id", "<>", 1))}, "edit", "post", nil)
+		require.Equal(t, Error("unknown operator: '<>'"), err)
+	})
+}
+
+func TestPartialEvalAgreesWithCan(t *testing.T) {
+	rule := func(access Access, cs ...Evaluator) *Rule {
+		return new(Rule).Access(access).Where(Action("edit"), ResourceType("post"), ResourceMatch(cs...))
+	}
+	subjects := map[string]Subject{
+		"rule list": RuleList{
+			rule(Deny, Cond("@locked", "=", true)),
+			rule(Allow, Cond("@author_id", "=", 1)),
+			rule(Deny, Cond("@status", "$in", []interface{}{"draft", "spam"})),
+			rule(Allow, Or(Cond("@public", "=", true), Cond("@tags", "&", []interface{}{"open"}))),
+		},
+		"prioritized rule list": RuleList{
+			rule(Allow, Cond("@author_id", "=", 1)),
+			rule(Deny, Cond("@locked", "=", true)).Priority(1),
+			rule(Allow, Cond("@public", "=", true)).Priority(2),
+		},
+		"intersection": Bounded(
+			RuleList{rule(Allow, Cond("@author_id", "=", 1)), rule(Allow, Cond("@public", "=", true))},
+			RuleList{rule(Deny, Cond("@locked", "=", true)), rule(Allow)},
+		),
+	}
+	authorizers := map[string]*Authorizer{
+		"first-applicable": NewAuthorizer(),
+		"deny-overrides":   NewAuthorizer(WithCombiningAlgorithm(DenyOverrides)),
+		"permit-overrides": NewAuthorizer(WithCombiningAlgorithm(PermitOverrides)),
+		"layered": NewAuthorizer(Layered(
+			Layer{Name: "guardrails", Rules: StaticRules(rule(Deny, Cond("@status", "=", "spam")))},
+			Layer{Name: "subject"},
+			Layer{Name: "fallback", Rules: StaticRules(rule(Allow, Cond("@status", "=", "open")))},
+		)),
+		"terminal layer": NewAuthorizer(Layered(
+			Layer{Name: "subject", Terminal: true},
+			Layer{Name: "fallback", Rules: StaticRules(rule(Allow))},
+		)),
+	}
+	var resources []testResource
+	for _, locked := range []bool{true, false} {
+		for _, author := range []int{1, 2} {
+			for _, public := range []bool{true, false} {
+				for _, status := range []string{"draft", "spam", "open"} {
+					for _, tags := range [][]string{{"open"}, {"closed"}} {
+						resources = append(resources, testResource{rtype: "post", attributes: map[string]interface{}{
+							"locked":    locked,
+							"author_id": author,
+							"public":    public,
+							"status":    status,
+							"tags":      tags,
+						}})
+					}
+				}
+			}
+		}
+	}
+	for an, a := range authorizers {
+		for sn, s := range subjects {
+			t.Run(fmt.Sprintf("%s with %s should agree with Can", an, sn), func(t *testing.T) {
+				e, err := a.PartialEval(s, "edit", "post", nil)
+				require.Nil(t, err)
+				for _, r := range resources {
+					want, err := a.Can(s, "edit", r)
+					require.Nil(t, err)
+					got, err := evalExpr(e, r)
+					require.Nil(t, err)
+					require.Equal(t, want, got, "%s for %v", e, r.attributes)
+				}
+			})
+		}
+	}
+}
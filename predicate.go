@@ -0,0 +1,146 @@
+package authr
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Predicate is a Go-native condition that can be embedded in the resource
+// match section of a rule alongside the built-in conditions. It is the
+// extension point for checks that cannot be expressed with operators, like
+// walking a relationship graph.
+//
+// Values from the Environment passed to CanWithEnv are available through env,
+// which is never nil.
+type Predicate interface {
+	Evaluate(r Resource, env Environment) (bool, error)
+}
+
+// PredicateFunc allows a plain function to be used as a Predicate.
+type PredicateFunc func(r Resource, env Environment) (bool, error)
+
+func (f PredicateFunc) Evaluate(r Resource, env Environment) (bool, error) {
+	return f(r, env)
+}
+
+// PredicateFactory builds a Predicate from the arguments of a named predicate.
+// Returning an error will reject the rule that references it.
+type PredicateFactory func(args []interface{}) (Predicate, error)
+
+var predicates = struct {
+	sync.RWMutex
+	m map[string]PredicateFactory
+}{m: make(map[string]PredicateFactory)}
+
+// RegisterPredicate makes a predicate available by name to Fn and to rules
+// unmarshaled from JSON, where it is referenced like so:
+//
+//	{"$fn": "shares_account", "args": ["admin"]}
+//
+// Predicates are resolved when a rule is built, so they should be registered
+// before any rules are unmarshaled, usually in an init function. It will panic
+// if the name is empty or already registered.
+func RegisterPredicate(name string, f PredicateFactory) {
+	predicates.Lock()
+	defer predicates.Unlock()
+	if name == "" {
+		panic("authr: RegisterPredicate called with an empty name")
+	}
+	if f == nil {
+		panic(fmt.Sprintf("authr: RegisterPredicate called with a nil factory for '%s'", name))
+	}
+	if _, ok := predicates.m[name]; ok {
+		panic(fmt.Sprintf("authr: predicate '%s' is already registered", name))
+	}
+	predicates.m[name] = f
+}
+
+func lookupPredicate(name string) (PredicateFactory, bool) {
+	predicates.RLock()
+	defer predicates.RUnlock()
+	f, ok := predicates.m[name]
+	return f, ok
+}
+
+// PredicateCall is the read-only view of an Evaluator returned from Fn or
+// Custom.
+type PredicateCall interface {
+	Evaluator
+	// Name returns the registered name of the predicate, or an empty string if
+	// it was provided with Custom.
+	Name() string
+	Args() []interface{}
+}
+
+type predicate struct {
+	name string
+	args []interface{}
+	p    Predicate
+	err  error
+}
+
+// Custom returns an Evaluator that defers to the provided Predicate. Rules
+// that contain custom predicates can only be built in Go. It will panic if the
+// predicate is nil.
+func Custom(p Predicate) Evaluator {
+	if isNilPredicate(p) {
+		panic("authr: Custom called with a nil predicate")
+	}
+	return predicate{p: p}
+}
+
+// Fn returns an Evaluator for a predicate registered with RegisterPredicate.
+// If the predicate is unknown or rejects the arguments, the returned Evaluator
+// will return that error when evaluated.
+func Fn(name string, args ...interface{}) Evaluator {
+	p, err := newPredicate(name, args)
+	if err != nil {
+		return predicate{name: name, args: args, err: err}
+	}
+	return p
+}
+
+func newPredicate(name string, args []interface{}) (predicate, error) {
+	f, ok := lookupPredicate(name)
+	if !ok {
+		return predicate{}, Error(fmt.Sprintf("unknown predicate: '%s'", name))
+	}
+	p, err := f(args)
+	if err != nil {
+		return predicate{}, err
+	}
+	if isNilPredicate(p) {
+		return predicate{}, Error(fmt.Sprintf("predicate factory for '%s' returned a nil predicate", name))
+	}
+	return predicate{name: name, args: args, p: p}, nil
+}
+
+// isNilPredicate reports whether p is nil, or a nil func, pointer or other
+// nillable value wrapped in the interface, which would panic when evaluated.
+func isNilPredicate(p Predicate) bool {
+	if p == nil {
+		return true
+	}
+	switch v := reflect.ValueOf(p); v.Kind() {
+	case reflect.Func, reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+func (p predicate) Name() string {
+	return p.name
+}
+
+func (p predicate) Args() []interface{} {
+	return append([]interface{}{}, p.args...)
+}
+
+func (p predicate) evaluate(r Resource) (bool, error) {
+	if p.err != nil {
+		return false, p.err
+	}
+	r, env := splitEnv(r)
+	return p.p.Evaluate(r, env)
+}
@@ -0,0 +1,166 @@
+package authr
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	RegisterPredicate("test_owned_by", func(args []interface{}) (Predicate, error) {
+		if len(args) != 1 {
+			return nil, errors.New("test_owned_by expects exactly one argument")
+		}
+		return PredicateFunc(func(r Resource, env Environment) (bool, error) {
+			owner, err := r.GetResourceAttribute("owner")
+			if err != nil {
+				return false, err
+			}
+			return looseEquality(owner, args[0])
+		}), nil
+	})
+	RegisterPredicate("test_nil", func([]interface{}) (Predicate, error) {
+		return nil, nil
+	})
+}
+
+func TestCustomPredicate(t *testing.T) {
+	t.Parallel()
+	r := testResource{rtype: "zone", attributes: map[string]interface{}{"id": "abc"}}
+	t.Run("should defer to the predicate", func(t *testing.T) {
+		var seen Resource
+		ok, err := Custom(PredicateFunc(func(r Resource, env Environment) (bool, error) {
+			seen = r
+			return true, nil
+		})).evaluate(r)
+		require.Nil(t, err)
+		require.True(t, ok)
+		require.Equal(t, r, seen)
+	})
+	t.Run("should receive the environment and unwrapped resource", func(t *testing.T) {
+		var seen Resource
+		ok, err := Custom(PredicateFunc(func(r Resource, env Environment) (bool, error) {
+			seen = r
+			v, err := env.GetEnvironmentValue("ip")
+			return v == "10.0.0.1", err
+		})).evaluate(envResource{Resource: r, env: Env{"ip": "10.0.0.1"}})
+		require.Nil(t, err)
+		require.True(t, ok)
+		require.Equal(t, r, seen)
+	})
+	t.Run("should receive an empty environment when none is given", func(t *testing.T) {
+		ok, err := Custom(PredicateFunc(func(r Resource, env Environment) (bool, error) {
+			require.NotNil(t, env)
+			return true, nil
+		})).evaluate(r)
+		require.Nil(t, err)
+		require.True(t, ok)
+	})
+	t.Run("should be usable inside a rule", func(t *testing.T) {
+		deny := Custom(PredicateFunc(func(Resource, Environment) (bool, error) {
+			return false, nil
+		}))
+		ok, err := Can(testSubject{rules: []*Rule{
+			new(Rule).Access(Allow).Where(Action("read"), ResourceType("zone"), ResourceMatch(deny)),
+			new(Rule).Access(Allow).Where(Action("read"), ResourceType("zone"), ResourceMatch(Cond("@id", "=", "abc"))),
+		}}, "read", r)
+		require.Nil(t, err)
+		require.True(t, ok)
+	})
+	t.Run("should panic on nil predicates", func(t *testing.T) {
+		require.Panics(t, func() { Custom(nil) })
+		require.Panics(t, func() { Custom(PredicateFunc(nil)) })
+	})
+}
+
+func TestFnPredicate(t *testing.T) {
+	t.Parallel()
+	r := testResource{rtype: "zone", attributes: map[string]interface{}{"owner": "jane"}}
+	t.Run("should resolve registered predicates", func(t *testing.T) {
+		ok, err := Fn("test_owned_by", "jane").evaluate(r)
+		require.Nil(t, err)
+		require.True(t, ok)
+	})
+	t.Run("should return err for unknown predicates", func(t *testing.T) {
+		_, err := Fn("test_nope").evaluate(r)
+		require.EqualError(t, err, "unknown predicate: 'test_nope'")
+	})
+	t.Run("should return err when the factory rejects the arguments", func(t *testing.T) {
+		_, err := Fn("test_owned_by").evaluate(r)
+		require.EqualError(t, err, "test_owned_by expects exactly one argument")
+	})
+	t.Run("should return err when the factory returns a nil predicate", func(t *testing.T) {
+		_, err := Fn("test_nil").evaluate(r)
+		require.EqualError(t, err, "predicate factory for 'test_nil' returned a nil predicate")
+	})
+	t.Run("should panic when registering a name twice", func(t *testing.T) {
+		require.Panics(t, func() {
+			RegisterPredicate("test_owned_by", func([]interface{}) (Predicate, error) { return nil, nil })
+		})
+	})
+}
+
+func TestPredicateUnmarshalJSON(t *testing.T) {
+	r := testResource{rtype: "zone", attributes: map[string]interface{}{"owner": "jane", "id": 3}}
+	cases := []struct {
+		n, d, err string
+		ok        bool
+	}{
+		{
+			n:  "should resolve a registered predicate",
+			d:  `{"access":"allow","where":{"action":"read","rsrc_type":"zone","rsrc_match":[{"$fn":"test_owned_by","args":["jane"]}]}}`,
+			ok: true,
+		},
+		{
+			n:  "should resolve predicates nested in condition sets",
+			d:  `{"access":"allow","where":{"action":"read","rsrc_type":"zone","rsrc_match":{"$or":[["@id","=",4],{"$fn":"test_owned_by","args":["jane"]}]}}}`,
+			ok: true,
+		},
+		{
+			n:   "should err for unknown predicates",
+			d:   `{"access":"allow","where":{"action":"read","rsrc_type":"zone","rsrc_match":[{"$fn":"test_nope"}]}}`,
+			err: `invalid value for property "where.rsrc_match.0.$fn", expecting registered predicate name, got "test_nope"`,
+		},
+		{
+			n:   "should err when the factory rejects the arguments",
+			d:   `{"access":"allow","where":{"action":"read","rsrc_type":"zone","rsrc_match":[{"$fn":"test_owned_by","args":[]}]}}`,
+			err: "test_owned_by expects exactly one argument",
+		},
+		{
+			n:   "should err when the factory returns a nil predicate",
+			d:   `{"access":"allow","where":{"action":"read","rsrc_type":"zone","rsrc_match":[{"$fn":"test_nil"}]}}`,
+			err: "predicate factory for 'test_nil' returned a nil predicate",
+		},
+		{
+			n:   "should err for a non-string name",
+			d:   `{"access":"allow","where":{"action":"read","rsrc_type":"zone","rsrc_match":[{"$fn":5}]}}`,
+			err: `expecting JSON string for property "where.rsrc_match.0.$fn", got JSON number`,
+		},
+		{
+			n:   "should err for non-array args",
+			d:   `{"access":"allow","where":{"action":"read","rsrc_type":"zone","rsrc_match":[{"$fn":"test_owned_by","args":"jane"}]}}`,
+			err: `expecting JSON array for property "where.rsrc_match.0.args", got JSON string`,
+		},
+		{
+			n:   "should err for unexpected keys",
+			d:   `{"access":"allow","where":{"action":"read","rsrc_type":"zone","rsrc_match":[{"$fn":"test_owned_by","argz":[]}]}}`,
+			err: `invalid value for property "where.rsrc_match.0": unexpected key "argz" in predicate, expected only "$fn" and "args"`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.n, func(t *testing.T) {
+			rule := new(Rule)
+			err := json.Unmarshal([]byte(c.d), rule)
+			if c.err != "" {
+				require.EqualError(t, err, c.err)
+				return
+			}
+			require.Nil(t, err)
+			ok, err := Can(testSubject{rules: []*Rule{rule}}, "read", r)
+			require.Nil(t, err)
+			require.Equal(t, c.ok, ok)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package authr
+
+// Reason explains a rule's decision, typically a denial, to end users. In
+// JSON, it is written on the rule:
+//
+//	"reason": {"code": "zone_locked", "message": "this zone is locked by your organization"}
+type Reason struct {
+	// Code is a machine-readable identifier for the reason.
+	Code string
+
+	// Message is a human-readable explanation that can be shown to end users.
+	Message string
+}
+
+// IsZero reports whether no reason was given.
+func (r Reason) IsZero() bool {
+	return r.Code == "" && r.Message == ""
+}
+
+// ErrForbidden is the error returned from Decision.Err for a denied attempt.
+// Its Code and Message, which are all that Error includes, are safe to render
+// to end users, for example in the body of an HTTP 403 response.
+type ErrForbidden struct {
+	// Code and Message are the Reason of the rule that denied the attempt,
+	// and are empty if it gave none or if no rule matched.
+	Code    string
+	Message string
+
+	// RuleIndex, RuleID and Layer identify the rule that denied the attempt,
+	// see Decision. They reveal how the policy is laid out, so they are meant
+	// for logs and should not be shown to end users.
+	RuleIndex int
+	RuleID    string
+	Layer     string
+}
+
+func (e *ErrForbidden) Error() string {
+	switch {
+	case e.Message != "":
+		return "forbidden: " + e.Message
+	case e.Code != "":
+		return "forbidden: " + e.Code
+	}
+	return "forbidden"
+}
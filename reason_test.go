@@ -0,0 +1,51 @@
+package authr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReasons(t *testing.T) {
+	locked := new(Rule).
+		Access(Deny).
+		Reason("zone_locked", "this zone is locked by your organization").
+		Where(Action("delete"), ResourceType("zone"), ResourceMatch(Cond("@locked", "=", true)))
+	allow := new(Rule).Access(Allow).Where(Action("delete"), ResourceType("zone"), ResourceMatch())
+	subject := RuleList{locked, allow}
+
+	t.Run("should return the reason of a denial", func(t *testing.T) {
+		d, err := Decide(subject, "delete", testResource{rtype: "zone", attributes: map[string]interface{}{"locked": true}})
+		require.Nil(t, err)
+		require.Equal(t, Reason{Code: "zone_locked", Message: "this zone is locked by your organization"}, d.Reason)
+
+		forbidden, ok := d.Err().(*ErrForbidden)
+		require.True(t, ok)
+		require.Equal(t, &ErrForbidden{
+			Code:      "zone_locked",
+			Message:   "this zone is locked by your organization",
+			RuleIndex: 0,
+		}, forbidden)
+		require.Equal(t, "forbidden: this zone is locked by your organization", forbidden.Error())
+	})
+	t.Run("should return no error when allowed", func(t *testing.T) {
+		d, err := Decide(subject, "delete", testResource{rtype: "zone"})
+		require.Nil(t, err)
+		require.True(t, d.Reason.IsZero())
+		require.Nil(t, d.Err())
+	})
+	t.Run("should return an empty reason when no rule matched", func(t *testing.T) {
+		d, err := Decide(subject, "purge", testResource{rtype: "zone"})
+		require.Nil(t, err)
+		require.Equal(t, &ErrForbidden{RuleIndex: -1}, d.Err())
+		require.Equal(t, "forbidden", d.Err().Error())
+	})
+	t.Run("should name the layer that denied", func(t *testing.T) {
+		d, err := Decide(Restrict(subject), "delete", testResource{rtype: "zone"})
+		require.Nil(t, err)
+		require.Equal(t, &ErrForbidden{RuleIndex: -1, Layer: "restriction"}, d.Err())
+	})
+	t.Run("should fall back to the code in the error message", func(t *testing.T) {
+		require.Equal(t, "forbidden: zone_locked", (&ErrForbidden{Code: "zone_locked"}).Error())
+	})
+}
@@ -0,0 +1,112 @@
+package authr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Role is a named, reusable group of rules. A role can inherit the rules of
+// other roles by name.
+type Role struct {
+	Name     string
+	Inherits []string
+	Rules    []*Rule
+}
+
+// RoleSet holds a collection of roles that subjects can be assembled from.
+// Authr still only ever sees a subject as a list of rules; a RoleSet simply
+// produces that list from role names.
+type RoleSet struct {
+	roles map[string]Role
+}
+
+// NewRoleSet validates the provided roles and returns a RoleSet holding them.
+// An error is returned if a name is empty or used more than once, if a role
+// inherits one that does not exist, or if inheritance forms a cycle.
+func NewRoleSet(roles ...Role) (*RoleSet, error) {
+	rs := &RoleSet{roles: make(map[string]Role, len(roles))}
+	for _, r := range roles {
+		if r.Name == "" {
+			return nil, Error("role name must not be empty")
+		}
+		if _, ok := rs.roles[r.Name]; ok {
+			return nil, Error(fmt.Sprintf("duplicate role: '%s'", r.Name))
+		}
+		rs.roles[r.Name] = r
+	}
+	names := make([]string, 0, len(rs.roles))
+	for name := range rs.roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// 0 = unvisited, 1 = visiting, 2 = done
+	state := make(map[string]int, len(rs.roles))
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		path = append(path, name)
+		switch state[name] {
+		case 1:
+			return Error(fmt.Sprintf("role inheritance cycle: %s", strings.Join(path, " -> ")))
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, parent := range rs.roles[name].Inherits {
+			if _, ok := rs.roles[parent]; !ok {
+				return Error(fmt.Sprintf("role '%s' inherits unknown role '%s'", name, parent))
+			}
+			if err := visit(parent, path); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return rs, nil
+}
+
+// Rules flattens the named roles into a single list of rules. Roles are
+// expanded in the order given, each one contributing its own rules before
+// those of the roles it inherits (in the order they are listed), so a role can
+// override what it inherits with its own rules. A role reached more than once
+// only contributes its rules the first time, so the result is always the same
+// for the same names.
+func (rs *RoleSet) Rules(names ...string) ([]*Rule, error) {
+	rules := []*Rule{}
+	seen := make(map[string]bool)
+	var expand func(name string)
+	expand = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		role := rs.roles[name]
+		rules = append(rules, role.Rules...)
+		for _, parent := range role.Inherits {
+			expand(parent)
+		}
+	}
+	for _, name := range names {
+		if _, ok := rs.roles[name]; !ok {
+			return nil, Error(fmt.Sprintf("unknown role: '%s'", name))
+		}
+		expand(name)
+	}
+	return rules, nil
+}
+
+// Subject returns a Subject whose GetRules returns the flattened rules of the
+// named roles, see Rules.
+func (rs *RoleSet) Subject(names ...string) (Subject, error) {
+	rules, err := rs.Rules(names...)
+	if err != nil {
+		return nil, err
+	}
+	return RuleList(rules), nil
+}
@@ -0,0 +1,119 @@
+package authr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRoleSet(t *testing.T) {
+	cases := []struct {
+		n     string
+		roles []Role
+		err   string
+	}{
+		{n: "should accept an empty set"},
+		{
+			n:     "should err on empty names",
+			roles: []Role{{Name: ""}},
+			err:   "role name must not be empty",
+		},
+		{
+			n:     "should err on duplicate names",
+			roles: []Role{{Name: "a"}, {Name: "a"}},
+			err:   "duplicate role: 'a'",
+		},
+		{
+			n:     "should err on unknown parents",
+			roles: []Role{{Name: "a", Inherits: []string{"b"}}},
+			err:   "role 'a' inherits unknown role 'b'",
+		},
+		{
+			n:     "should err on self inheritance",
+			roles: []Role{{Name: "a", Inherits: []string{"a"}}},
+			err:   "role inheritance cycle: a -> a",
+		},
+		{
+			n: "should err on inheritance cycles",
+			roles: []Role{
+				{Name: "a", Inherits: []string{"b"}},
+				{Name: "b", Inherits: []string{"c"}},
+				{Name: "c", Inherits: []string{"a"}},
+			},
+			err: "role inheritance cycle: a -> b -> c -> a",
+		},
+		{
+			n: "should accept diamonds",
+			roles: []Role{
+				{Name: "a", Inherits: []string{"b", "c"}},
+				{Name: "b", Inherits: []string{"d"}},
+				{Name: "c", Inherits: []string{"d"}},
+				{Name: "d"},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.n, func(t *testing.T) {
+			rs, err := NewRoleSet(c.roles...)
+			if c.err != "" {
+				require.EqualError(t, err, c.err)
+				return
+			}
+			require.Nil(t, err)
+			require.NotNil(t, rs)
+		})
+	}
+}
+
+func TestRoleSet(t *testing.T) {
+	rule := func(access Access, action string) *Rule {
+		return new(Rule).Access(access).Where(Action(action), ResourceType("zone"), ResourceMatch())
+	}
+	var (
+		viewZone    = rule(Allow, "view")
+		editZone    = rule(Allow, "edit")
+		denyDelete  = rule(Deny, "delete")
+		deleteZone  = rule(Allow, "delete")
+		viewBilling = new(Rule).Access(Allow).Where(Action("view"), ResourceType("invoice"), ResourceMatch())
+	)
+	rs, err := NewRoleSet(
+		Role{Name: "zone_viewer", Rules: []*Rule{viewZone}},
+		Role{Name: "zone_editor", Inherits: []string{"zone_viewer"}, Rules: []*Rule{editZone}},
+		Role{Name: "zone_admin", Inherits: []string{"zone_editor", "zone_viewer"}, Rules: []*Rule{deleteZone}},
+		Role{Name: "locked", Rules: []*Rule{denyDelete}},
+		Role{Name: "billing_viewer", Rules: []*Rule{viewBilling}},
+	)
+	require.Nil(t, err)
+
+	t.Run("should flatten inherited roles after their own rules", func(t *testing.T) {
+		rules, err := rs.Rules("zone_admin")
+		require.Nil(t, err)
+		require.Equal(t, []*Rule{deleteZone, editZone, viewZone}, rules)
+	})
+	t.Run("should expand roles in the order given without repeats", func(t *testing.T) {
+		rules, err := rs.Rules("locked", "zone_editor", "billing_viewer", "zone_admin", "locked")
+		require.Nil(t, err)
+		require.Equal(t, []*Rule{denyDelete, editZone, viewZone, viewBilling, deleteZone}, rules)
+	})
+	t.Run("should err on unknown roles", func(t *testing.T) {
+		_, err := rs.Rules("zone_viewer", "nope")
+		require.EqualError(t, err, "unknown role: 'nope'")
+	})
+	t.Run("should produce a subject usable with Can", func(t *testing.T) {
+		zone := testResource{rtype: "zone"}
+		admin, err := rs.Subject("zone_admin")
+		require.Nil(t, err)
+		ok, err := Can(admin, "delete", zone)
+		require.Nil(t, err)
+		require.True(t, ok)
+
+		lockedAdmin, err := rs.Subject("locked", "zone_admin")
+		require.Nil(t, err)
+		ok, err = Can(lockedAdmin, "delete", zone)
+		require.Nil(t, err)
+		require.False(t, ok)
+		ok, err = Can(lockedAdmin, "edit", zone)
+		require.Nil(t, err)
+		require.True(t, ok)
+	})
+}
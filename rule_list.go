@@ -0,0 +1,69 @@
+package authr
+
+import "fmt"
+
+// RuleList is a Subject whose rules are a static list.
+type RuleList []*Rule
+
+func (l RuleList) GetRules() ([]*Rule, error) {
+	return l, nil
+}
+
+// Validate checks that no two rules in the list share an ID. Rules without an
+// ID are ignored.
+func (l RuleList) Validate() error {
+	seen := make(map[string]int, len(l))
+	for i, r := range l {
+		if r.id == "" {
+			continue
+		}
+		if j, ok := seen[r.id]; ok {
+			return Error(fmt.Sprintf("duplicate rule id '%s' at %d and %d", r.id, j, i))
+		}
+		seen[r.id] = i
+	}
+	return nil
+}
+
+// Find returns the rule with the given ID and its index in the list, or nil and
+// -1 if there is no such rule.
+func (l RuleList) Find(id string) (*Rule, int) {
+	if id == "" {
+		return nil, -1
+	}
+	for i, r := range l {
+		if r.id == id {
+			return r, i
+		}
+	}
+	return nil, -1
+}
+
+// Replace returns a copy of the list with the rule sharing the ID of the
+// provided rule replaced by it, keeping its position. An error is returned if
+// the rule has no ID or if no rule in the list has its ID.
+func (l RuleList) Replace(rule *Rule) (RuleList, error) {
+	if rule.id == "" {
+		return nil, Error("cannot replace a rule without an id")
+	}
+	_, i := l.Find(rule.id)
+	if i < 0 {
+		return nil, Error(fmt.Sprintf("unknown rule id: '%s'", rule.id))
+	}
+	replaced := make(RuleList, len(l))
+	copy(replaced, l)
+	replaced[i] = rule
+	return replaced, nil
+}
+
+// Remove returns a copy of the list without the rule with the given ID, and
+// whether such a rule was found.
+func (l RuleList) Remove(id string) (RuleList, bool) {
+	_, i := l.Find(id)
+	if i < 0 {
+		return l, false
+	}
+	removed := make(RuleList, 0, len(l)-1)
+	removed = append(removed, l[:i]...)
+	return append(removed, l[i+1:]...), true
+}
@@ -0,0 +1,61 @@
+package authr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleList(t *testing.T) {
+	rule := func(id string, access Access) *Rule {
+		return new(Rule).ID(id).Access(access).Where(Action("delete"), ResourceType("zone"), ResourceMatch())
+	}
+	a, b, c := rule("a", Allow), rule("b", Deny), rule("c", Allow)
+	anonymous := rule("", Allow)
+	l := RuleList{a, anonymous, b, c, anonymous}
+
+	t.Run("should validate unique ids", func(t *testing.T) {
+		require.Nil(t, l.Validate())
+		require.Equal(t, Error("duplicate rule id 'b' at 2 and 4"), RuleList{a, anonymous, b, c, rule("b", Allow)}.Validate())
+	})
+	t.Run("should find rules by id", func(t *testing.T) {
+		r, i := l.Find("b")
+		require.Equal(t, b, r)
+		require.Equal(t, 2, i)
+		r, i = l.Find("z")
+		require.Nil(t, r)
+		require.Equal(t, -1, i)
+		r, i = l.Find("")
+		require.Nil(t, r)
+		require.Equal(t, -1, i)
+	})
+	t.Run("should replace rules by id", func(t *testing.T) {
+		b2 := rule("b", Allow).Version(2)
+		replaced, err := l.Replace(b2)
+		require.Nil(t, err)
+		require.Equal(t, RuleList{a, anonymous, b2, c, anonymous}, replaced)
+		require.Equal(t, b, l[2], "the original list should be untouched")
+
+		_, err = l.Replace(rule("z", Allow))
+		require.Equal(t, Error("unknown rule id: 'z'"), err)
+		_, err = l.Replace(anonymous)
+		require.Equal(t, Error("cannot replace a rule without an id"), err)
+	})
+	t.Run("should remove rules by id", func(t *testing.T) {
+		removed, ok := l.Remove("a")
+		require.True(t, ok)
+		require.Equal(t, RuleList{anonymous, b, c, anonymous}, removed)
+		require.Equal(t, a, l[0], "the original list should be untouched")
+
+		removed, ok = l.Remove("z")
+		require.False(t, ok)
+		require.Equal(t, l, removed)
+	})
+	t.Run("should report the id of the deciding rule", func(t *testing.T) {
+		d, err := Decide(RuleList{b, a}, "delete", testResource{rtype: "zone"})
+		require.Nil(t, err)
+		require.Equal(t, "b", d.RuleID)
+		require.Equal(t, `denied by rule "b"`, d.String())
+		require.Equal(t, "b", d.Err().(*ErrForbidden).RuleID)
+	})
+}
@@ -0,0 +1,230 @@
+package authr
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Param is a placeholder for a value that is not known until a subject is
+// instantiated, like the subject's own ID:
+//
+//	Cond("@author_id", "=", Param("user_id"))
+//
+// In JSON, a placeholder is written as an object with a single "$param" key:
+//
+//	["@author_id", "=", {"$param": "user_id"}]
+//
+// Rules containing placeholders must be bound with a Template before use,
+// evaluating an unbound placeholder is an error.
+type Param string
+
+// ParamType is the type of value a Template parameter accepts.
+type ParamType string
+
+const (
+	// ParamString accepts Go strings
+	ParamString ParamType = "string"
+
+	// ParamNumber accepts any Go integer or floating-point number
+	ParamNumber ParamType = "number"
+
+	// ParamBool accepts Go booleans
+	ParamBool ParamType = "bool"
+
+	// ParamList accepts Go arrays and slices
+	ParamList ParamType = "list"
+
+	// ParamAny accepts any value, including nil
+	ParamAny ParamType = "any"
+)
+
+func (p ParamType) valid() bool {
+	switch p {
+	case ParamString, ParamNumber, ParamBool, ParamList, ParamAny:
+		return true
+	}
+	return false
+}
+
+func (p ParamType) accepts(v interface{}) bool {
+	switch p {
+	case ParamString:
+		_, ok := v.(string)
+		return ok
+	case ParamNumber:
+		return isnumber(v)
+	case ParamBool:
+		_, ok := v.(bool)
+		return ok
+	case ParamList:
+		return v != nil && isArrayIsh(reflect.ValueOf(v))
+	case ParamAny:
+		return true
+	}
+	return false
+}
+
+// Template is a list of rules containing Param placeholders along with the
+// declared type of every parameter.
+type Template struct {
+	params map[string]ParamType
+	rules  []*Rule
+}
+
+// NewTemplate validates that every placeholder used in the rules is declared
+// in params with a known type, and returns a Template for binding them.
+// Placeholders may be used as condition operands or as elements of array
+// operands, except for list parameters, but not as predicate arguments.
+func NewTemplate(params map[string]ParamType, rules ...*Rule) (*Template, error) {
+	declared := make(map[string]ParamType, len(params))
+	for name, typ := range params {
+		if !typ.valid() {
+			return nil, Error(fmt.Sprintf("unknown type '%s' for parameter '%s'", typ, name))
+		}
+		declared[name] = typ
+	}
+	for i, r := range rules {
+		err := Walk(r.where.resourceMatch, func(path []string, e Evaluator) error {
+			switch n := e.(type) {
+			case condition:
+				for _, operand := range []interface{}{n.left, n.right} {
+					_, isList := operand.([]interface{})
+					if err := forEachParam(operand, func(p Param) error {
+						typ, ok := declared[string(p)]
+						if !ok {
+							return Error(fmt.Sprintf("undeclared parameter '%s' in rule %d at %s", p, i, strings.Join(path, ".")))
+						}
+						if isList && typ == ParamList {
+							return Error(fmt.Sprintf("list parameter '%s' cannot be used as a list element in rule %d at %s", p, i, strings.Join(path, ".")))
+						}
+						return nil
+					}); err != nil {
+						return err
+					}
+				}
+			case predicate:
+				for _, arg := range n.args {
+					if err := forEachParam(arg, func(p Param) error {
+						return Error(fmt.Sprintf("parameter '%s' cannot be used as a predicate argument in rule %d at %s", p, i, strings.Join(path, ".")))
+					}); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &Template{params: declared, rules: rules}, nil
+}
+
+// Bind returns a copy of the template's rules with every placeholder replaced
+// by its value. Every declared parameter must be provided a value of its
+// declared type, and values for undeclared parameters are rejected. Bound
+// strings are always literal values, even if they start with "@" or "$env.",
+// so that a value like a user's name cannot reference an attribute.
+func (t *Template) Bind(values map[string]interface{}) (RuleList, error) {
+	names := make([]string, 0, len(t.params))
+	for name := range t.params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v, ok := values[name]
+		if !ok {
+			return nil, Error(fmt.Sprintf("missing value for parameter '%s'", name))
+		}
+		if typ := t.params[name]; !typ.accepts(v) {
+			return nil, Error(fmt.Sprintf("parameter '%s' expects a %s, received %T", name, typ, v))
+		}
+	}
+	for name := range values {
+		if _, ok := t.params[name]; !ok {
+			return nil, Error(fmt.Sprintf("unknown parameter '%s'", name))
+		}
+	}
+	rules := make(RuleList, len(t.rules))
+	for i, r := range t.rules {
+		bound := *r
+		bound.where.resourceMatch = bindConditionSet(r.where.resourceMatch, values)
+		rules[i] = &bound
+	}
+	return rules, nil
+}
+
+func bindConditionSet(cs ConditionSet, values map[string]interface{}) ConditionSet {
+	bound := ConditionSet{conj: cs.conj, evaluators: make([]Evaluator, len(cs.evaluators))}
+	for i, e := range cs.evaluators {
+		switch n := e.(type) {
+		case ConditionSet:
+			bound.evaluators[i] = bindConditionSet(n, values)
+		case condition:
+			bound.evaluators[i] = condition{
+				left:  bindOperand(n.left, values),
+				op:    n.op,
+				right: bindOperand(n.right, values),
+			}
+		default:
+			bound.evaluators[i] = e
+		}
+	}
+	return bound
+}
+
+func bindOperand(operand interface{}, values map[string]interface{}) interface{} {
+	if p, ok := operand.(Param); ok {
+		if str, ok := values[string(p)].(string); ok {
+			return literal(str)
+		}
+		return values[string(p)]
+	}
+	return bindElements(operand, values)
+}
+
+// bindElements binds the placeholders in the elements of an array operand.
+// Elements are never resolved as references, so strings are bound as is.
+func bindElements(operand interface{}, values map[string]interface{}) interface{} {
+	switch o := operand.(type) {
+	case Param:
+		return values[string(o)]
+	case []interface{}:
+		bound := make([]interface{}, len(o))
+		for i, v := range o {
+			bound[i] = bindElements(v, values)
+		}
+		return bound
+	}
+	return operand
+}
+
+// literal is a string bound to a placeholder, which is never resolved as a
+// reference to a resource attribute or environment value.
+type literal string
+
+// escaped returns the literal the way it is written in rules, with the "\\"
+// prefix if it would otherwise be a reference.
+func (l literal) escaped() string {
+	str := string(l)
+	if strings.HasPrefix(str, "@") || strings.HasPrefix(str, envPrefix) {
+		return "\\" + str
+	}
+	return str
+}
+
+func forEachParam(operand interface{}, fn func(Param) error) error {
+	switch o := operand.(type) {
+	case Param:
+		return fn(o)
+	case []interface{}:
+		for _, v := range o {
+			if err := forEachParam(v, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package authr
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTemplate(t *testing.T) {
+	rule := func(es ...Evaluator) *Rule {
+		return new(Rule).Access(Allow).Where(Action("edit"), ResourceType("post"), ResourceMatch(es...))
+	}
+	cases := []struct {
+		n      string
+		params map[string]ParamType
+		rules  []*Rule
+		err    string
+	}{
+		{
+			n:      "should accept declared parameters",
+			params: map[string]ParamType{"user_id": ParamString, "groups": ParamList},
+			rules: []*Rule{rule(
+				Cond("@author_id", "=", Param("user_id")),
+				Or(Cond("@group", "$in", Param("groups"))),
+				Cond("@editor_id", "$in", []interface{}{"admin", Param("user_id")}),
+			)},
+		},
+		{
+			n:      "should err on list parameters in lists",
+			params: map[string]ParamType{"groups": ParamList},
+			rules:  []*Rule{rule(Cond("@group", "$in", []interface{}{"admins", Param("groups")}))},
+			err:    "list parameter 'groups' cannot be used as a list element in rule 0 at $and.0",
+		},
+		{
+			n:      "should err on unknown parameter types",
+			params: map[string]ParamType{"user_id": "uuid"},
+			err:    "unknown type 'uuid' for parameter 'user_id'",
+		},
+		{
+			n:      "should err on undeclared parameters",
+			params: map[string]ParamType{"user_id": ParamString},
+			rules: []*Rule{
+				rule(Cond("@author_id", "=", Param("user_id"))),
+				rule(Or(Cond("@id", "=", 1), Cond(Param("org_id"), "=", "@org_id"))),
+			},
+			err: "undeclared parameter 'org_id' in rule 1 at $and.0.$or.1",
+		},
+		{
+			n:      "should err on parameters in predicate arguments",
+			params: map[string]ParamType{"user_id": ParamString},
+			rules:  []*Rule{rule(Fn("test_owned_by", Param("user_id")))},
+			err:    "parameter 'user_id' cannot be used as a predicate argument in rule 0 at $and.0",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.n, func(t *testing.T) {
+			_, err := NewTemplate(c.params, c.rules...)
+			if c.err != "" {
+				require.EqualError(t, err, c.err)
+				return
+			}
+			require.Nil(t, err)
+		})
+	}
+}
+
+func TestTemplateBind(t *testing.T) {
+	tpl, err := NewTemplate(
+		map[string]ParamType{"user_id": ParamNumber, "editor": ParamBool},
+		new(Rule).Access(Allow).Where(
+			Action("edit"),
+			ResourceType("post"),
+			ResourceMatch(
+				Cond("@author_id", "=", Param("user_id")),
+				Cond(Param("editor"), "=", true),
+			),
+		),
+		new(Rule).Access(Allow).Where(
+			Action("view"),
+			ResourceType("post"),
+			ResourceMatch(Cond("@reader_id", "$in", []interface{}{0, Param("user_id")})),
+		),
+	)
+	require.Nil(t, err)
+	post := testResource{rtype: "post", attributes: map[string]interface{}{"author_id": 12, "reader_id": "12"}}
+
+	t.Run("should bind values into copies of the rules", func(t *testing.T) {
+		subject, err := tpl.Bind(map[string]interface{}{"user_id": 12, "editor": true})
+		require.Nil(t, err)
+		for _, action := range []string{"edit", "view"} {
+			ok, err := Can(subject, action, post)
+			require.Nil(t, err)
+			require.True(t, ok, action)
+		}
+		other, err := tpl.Bind(map[string]interface{}{"user_id": 13, "editor": true})
+		require.Nil(t, err)
+		ok, err := Can(other, "edit", post)
+		require.Nil(t, err)
+		require.False(t, ok)
+		// binding must not have touched the template or the first subject
+		ok, err = Can(subject, "edit", post)
+		require.Nil(t, err)
+		require.True(t, ok)
+	})
+	t.Run("should err on missing values", func(t *testing.T) {
+		_, err := tpl.Bind(map[string]interface{}{"user_id": 12})
+		require.EqualError(t, err, "missing value for parameter 'editor'")
+	})
+	t.Run("should err on values of the wrong type", func(t *testing.T) {
+		_, err := tpl.Bind(map[string]interface{}{"user_id": "12", "editor": true})
+		require.EqualError(t, err, "parameter 'user_id' expects a number, received string")
+	})
+	t.Run("should err on unknown values", func(t *testing.T) {
+		_, err := tpl.Bind(map[string]interface{}{"user_id": 12, "editor": true, "org": 1})
+		require.EqualError(t, err, "unknown parameter 'org'")
+	})
+	t.Run("should never resolve bound strings as references", func(t *testing.T) {
+		tpl, err := NewTemplate(
+			map[string]ParamType{"name": ParamString},
+			new(Rule).Access(Allow).Where(Action("edit"), ResourceType("post"), ResourceMatch(Cond("@owner_name", "=", Param("name")))),
+		)
+		require.Nil(t, err)
+		post := testResource{rtype: "post", attributes: map[string]interface{}{"owner_name": "mallory", "@owner_name": "x"}}
+		for _, name := range []string{"@owner_name", "$env.name"} {
+			subject, err := tpl.Bind(map[string]interface{}{"name": name})
+			require.Nil(t, err)
+			ok, err := CanWithEnv(subject, "edit", post, Env{"name": "mallory"})
+			require.Nil(t, err)
+			require.False(t, ok, name)
+			ok, err = CanWithEnv(subject, "edit", testResource{rtype: "post", attributes: map[string]interface{}{"owner_name": name}}, Env{})
+			require.Nil(t, err)
+			require.True(t, ok, name)
+
+			c := subject[0].where.resourceMatch.evaluators[0].(Condition)
+			require.Equal(t, "\\"+name, c.Right())
+			raw, err := json.Marshal(subject[0])
+			require.Nil(t, err)
+			var unmarshaled Rule
+			require.Nil(t, json.Unmarshal(raw, &unmarshaled))
+			ok, err = CanWithEnv(RuleList{&unmarshaled}, "edit", post, Env{"name": "mallory"})
+			require.Nil(t, err)
+			require.False(t, ok, name)
+		}
+	})
+	t.Run("should bind strings in lists", func(t *testing.T) {
+		tpl, err := NewTemplate(
+			map[string]ParamType{"uid": ParamString},
+			new(Rule).Access(Allow).Where(Action("edit"), ResourceType("post"), ResourceMatch(Cond("@author_id", "$in", []interface{}{Param("uid"), "admin"}))),
+		)
+		require.Nil(t, err)
+		subject, err := tpl.Bind(map[string]interface{}{"uid": "u1"})
+		require.Nil(t, err)
+		for author, want := range map[string]bool{"u1": true, "admin": true, "u2": false} {
+			ok, err := Can(subject, "edit", testResource{rtype: "post", attributes: map[string]interface{}{"author_id": author}})
+			require.Nil(t, err)
+			require.Equal(t, want, ok, author)
+		}
+	})
+	t.Run("should err when evaluating unbound parameters", func(t *testing.T) {
+		_, err := Cond("@author_id", "=", Param("user_id")).evaluate(post)
+		require.EqualError(t, err, "unbound parameter: 'user_id'")
+	})
+}
+
+func TestParamUnmarshalJSON(t *testing.T) {
+	t.Run("should unmarshal placeholders in operands", func(t *testing.T) {
+		r := new(Rule)
+		err := json.Unmarshal([]byte(`{"access":"allow","where":{"action":"edit","rsrc_type":"post","rsrc_match":[
+			["@author_id","=",{"$param":"user_id"}],
+			["@group","$in",["admins",{"$param":"group"}]],
+			["@labels","$hasentry",{"env":"prod"}]
+		]}}`), r)
+		require.Nil(t, err)
+		require.Equal(t, new(Rule).Access(Allow).Where(
+			Action("edit"),
+			ResourceType("post"),
+			ResourceMatch(
+				Cond("@author_id", "=", Param("user_id")),
+				Cond("@group", "$in", []interface{}{"admins", Param("group")}),
+				Cond("@labels", "$hasentry", map[string]interface{}{"env": "prod"}),
+			),
+		), r)
+	})
+	t.Run("should err on invalid placeholder names", func(t *testing.T) {
+		err := json.Unmarshal([]byte(`{"access":"allow","where":{"action":"edit","rsrc_type":"post","rsrc_match":[["@author_id","=",{"$param":4}]]}}`), new(Rule))
+		require.EqualError(t, err, `expecting JSON string for property "where.rsrc_match.0.2.$param", got JSON number`)
+	})
+}
@@ -0,0 +1,47 @@
+package authr
+
+import "strconv"
+
+// SkipChildren can be returned from a WalkFunc to skip the evaluators inside
+// of the ConditionSet being visited.
+const SkipChildren Error = "skip children"
+
+// WalkFunc is called by Walk for every Evaluator it visits. The path locates e
+// relative to where the walk started; the evaluators of a condition set are
+// found under its conjunction and their index, like "$and", "1", "$or", "0".
+//
+// Use a type switch to inspect what is being visited: Condition for a single
+// condition, ConditionSet for nested sets and PredicateCall for predicates.
+// Returning an error will halt the walk and return that error from Walk,
+// except for SkipChildren.
+type WalkFunc func(path []string, e Evaluator) error
+
+// Walk visits e and, if it is a ConditionSet, every evaluator inside of it in
+// depth-first order. To walk the conditions of a rule, use:
+//
+//	authr.Walk(rule.Conditions(), fn)
+func Walk(e Evaluator, fn WalkFunc) error {
+	return walk([]string{}, e, fn)
+}
+
+func walk(path []string, e Evaluator, fn WalkFunc) error {
+	if err := fn(path, e); err != nil {
+		if err == SkipChildren {
+			return nil
+		}
+		return err
+	}
+	cs, ok := e.(ConditionSet)
+	if !ok {
+		return nil
+	}
+	for i, sub := range cs.evaluators {
+		subpath := make([]string, len(path), len(path)+2)
+		copy(subpath, path)
+		subpath = append(subpath, cs.conj.String(), strconv.Itoa(i))
+		if err := walk(subpath, sub, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package authr
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalk(t *testing.T) {
+	cs := ResourceMatch(
+		Cond("@id", "!=", "1"),
+		Or(
+			Cond("@status", "=", "active"),
+			Cond("@deleted_date", "=", nil),
+		),
+		Custom(PredicateFunc(func(Resource, Environment) (bool, error) { return true, nil })),
+	)
+	t.Run("should visit every evaluator depth-first with its path", func(t *testing.T) {
+		visited := []string{}
+		err := Walk(cs, func(path []string, e Evaluator) error {
+			p := strings.Join(path, ".")
+			switch n := e.(type) {
+			case Condition:
+				visited = append(visited, p+" cond "+n.Operator())
+			case ConditionSet:
+				visited = append(visited, p+" set "+n.Conjunction())
+			case PredicateCall:
+				visited = append(visited, p+" fn "+n.Name())
+			}
+			return nil
+		})
+		require.Nil(t, err)
+		require.Equal(t, []string{
+			" set $and",
+			"$and.0 cond !=",
+			"$and.1 set $or",
+			"$and.1.$or.0 cond =",
+			"$and.1.$or.1 cond =",
+			"$and.2 fn ",
+		}, visited)
+	})
+	t.Run("should expose condition operands", func(t *testing.T) {
+		var c Condition
+		_ = Walk(cs, func(path []string, e Evaluator) error {
+			if strings.Join(path, ".") == "$and.1.$or.0" {
+				c = e.(Condition)
+			}
+			return nil
+		})
+		require.NotNil(t, c)
+		require.Equal(t, "@status", c.Left())
+		require.Equal(t, "active", c.Right())
+	})
+	t.Run("should skip children of a set when asked", func(t *testing.T) {
+		n := 0
+		err := Walk(cs, func(path []string, e Evaluator) error {
+			n++
+			if cs, ok := e.(ConditionSet); ok && cs.Conjunction() == "$or" {
+				return SkipChildren
+			}
+			return nil
+		})
+		require.Nil(t, err)
+		require.Equal(t, 4, n)
+	})
+	t.Run("should halt and return errors", func(t *testing.T) {
+		stop := errors.New("stop")
+		n := 0
+		err := Walk(cs, func(path []string, e Evaluator) error {
+			n++
+			if _, ok := e.(Condition); ok {
+				return stop
+			}
+			return nil
+		})
+		require.Equal(t, stop, err)
+		require.Equal(t, 2, n)
+	})
+}